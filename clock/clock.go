@@ -0,0 +1,221 @@
+// Package clock is an abstraction over the parts of the time package the
+// examples rely on, so their tests can move time forward by hand instead of
+// sleeping through it.
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// A Clock tells the time and waits for it to pass.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+	Tick(d time.Duration) <-chan time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+// A Timer is the time.Timer of a Clock. Unlike a channel from After, it can be
+// stopped once nobody waits for it any more.
+type Timer interface {
+	C() <-chan time.Time
+	// Stop prevents the Timer from firing, it returns false if it had
+	// already fired or been stopped.
+	Stop() bool
+}
+
+// A Ticker is the time.Ticker of a Clock. Unlike a channel from Tick, it can
+// be stopped once nobody reads it any more.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// New returns the Clock of the time package.
+func New() Clock {
+	return realClock{}
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) Tick(d time.Duration) <-chan time.Time  { return time.Tick(d) }
+func (realClock) NewTimer(d time.Duration) Timer         { return realTimer{time.NewTimer(d)} }
+func (realClock) NewTicker(d time.Duration) Ticker       { return realTicker{time.NewTicker(d)} }
+
+type realTimer struct{ t *time.Timer }
+
+func (t realTimer) C() <-chan time.Time { return t.t.C }
+func (t realTimer) Stop() bool          { return t.t.Stop() }
+
+type realTicker struct{ t *time.Ticker }
+
+func (t realTicker) C() <-chan time.Time { return t.t.C }
+func (t realTicker) Stop()               { t.t.Stop() }
+
+// A Fake is a Clock whose time only passes when Advance is called. It's safe
+// for concurrent use.
+type Fake struct {
+	mu   sync.Mutex
+	cond *sync.Cond // signalled whenever a waiter is added
+	now  time.Time
+	// the timers and tickers that haven't fired or been stopped yet, the
+	// channels of After and Sleep are among them until they fire
+	waiters []*waiter
+}
+
+// A waiter is a channel waiting for a time, period is set for a ticker.
+type waiter struct {
+	until  time.Time
+	period time.Duration
+	ch     chan time.Time
+}
+
+// NewFake returns a Fake that starts at now.
+func NewFake(now time.Time) *Fake {
+	f := &Fake{now: now}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+// Now returns the time the fake clock is at.
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.now
+}
+
+// Sleep blocks until the clock has been advanced by d.
+func (f *Fake) Sleep(d time.Duration) {
+	<-f.After(d)
+}
+
+// After returns a channel that gets the time once the clock has been advanced
+// by d. The channel waits on the clock until then even if nobody receives
+// from it any more, NewTimer makes one that can be stopped.
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	return f.add(d, 0).ch
+}
+
+// Tick returns a channel that gets the time every time the clock goes past
+// another d. Like time.Tick, ticks are dropped when nobody reads them and
+// nothing ever stops it, NewTicker makes one that can be stopped. It returns
+// nil if d <= 0.
+func (f *Fake) Tick(d time.Duration) <-chan time.Time {
+	if d <= 0 {
+		return nil
+	}
+	return f.add(d, d).ch
+}
+
+// NewTimer returns a Timer that fires once the clock has been advanced by d.
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	return fakeTimer{f, f.add(d, 0)}
+}
+
+// NewTicker returns a Ticker that ticks every time the clock goes past
+// another d. It panics if d <= 0, like time.NewTicker.
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	return fakeTicker{f, f.add(d, d)}
+}
+
+func (f *Fake) add(d, period time.Duration) *waiter {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// buffered so firing never blocks, just like the time package
+	w := &waiter{until: f.now.Add(d), period: period, ch: make(chan time.Time, 1)}
+	if d <= 0 && period == 0 {
+		w.ch <- f.now
+		return w
+	}
+
+	f.waiters = append(f.waiters, w)
+	f.cond.Broadcast()
+	return w
+}
+
+// remove stops w from waiting on the clock, it returns false if it wasn't.
+func (f *Fake) remove(w *waiter) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, v := range f.waiters {
+		if v == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTimer struct {
+	f *Fake
+	w *waiter
+}
+
+func (t fakeTimer) C() <-chan time.Time { return t.w.ch }
+func (t fakeTimer) Stop() bool          { return t.f.remove(t.w) }
+
+type fakeTicker struct {
+	f *Fake
+	w *waiter
+}
+
+func (t fakeTicker) C() <-chan time.Time { return t.w.ch }
+func (t fakeTicker) Stop()               { t.f.remove(t.w) }
+
+// Advance moves the clock forward by d and fires, in order, everything that
+// was waiting for a time up to the new one.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	end := f.now.Add(d)
+	for {
+		sort.SliceStable(f.waiters, func(i, j int) bool {
+			return f.waiters[i].until.Before(f.waiters[j].until)
+		})
+
+		if len(f.waiters) == 0 || f.waiters[0].until.After(end) {
+			break
+		}
+
+		w := f.waiters[0]
+		f.now = w.until
+		select {
+		case w.ch <- f.now:
+		default: // a tick nobody read yet, drop this one
+		}
+
+		if w.period > 0 {
+			w.until = w.until.Add(w.period)
+			continue
+		}
+		f.waiters = f.waiters[1:]
+	}
+	f.now = end
+}
+
+// BlockUntil blocks until at least n channels are waiting on the clock,
+// tickers included and stopped timers and tickers left out. It's how a test
+// knows the code under test got to the point it waits before advancing the
+// clock.
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for len(f.waiters) < n {
+		f.cond.Wait()
+	}
+}
@@ -0,0 +1,133 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var start = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestFakeAfter(t *testing.T) {
+	f := NewFake(start)
+	c := f.After(time.Second)
+
+	f.Advance(999 * time.Millisecond)
+	select {
+	case <-c:
+		t.Fatal("After() fired before its time")
+	default:
+	}
+
+	f.Advance(time.Millisecond)
+	select {
+	case got := <-c:
+		if want := start.Add(time.Second); !got.Equal(want) {
+			t.Errorf("After() got %v; want %v", got, want)
+		}
+	default:
+		t.Fatal("After() didn't fire once its time came")
+	}
+
+	if got, want := f.Now(), start.Add(time.Second); !got.Equal(want) {
+		t.Errorf("Now() got %v; want %v", got, want)
+	}
+}
+
+func TestFakeTick(t *testing.T) {
+	f := NewFake(start)
+	c := f.Tick(time.Second)
+
+	for i := 1; i <= 3; i++ {
+		f.Advance(time.Second)
+		select {
+		case got := <-c:
+			if want := start.Add(time.Duration(i) * time.Second); !got.Equal(want) {
+				t.Errorf("tick %d got %v; want %v", i, got, want)
+			}
+		default:
+			t.Fatalf("tick %d didn't fire", i)
+		}
+	}
+
+	// ticks nobody reads are dropped, like time.Tick does
+	f.Advance(5 * time.Second)
+	<-c
+	select {
+	case <-c:
+		t.Error("Tick() kept more than one tick nobody read")
+	default:
+	}
+}
+
+func TestFakeSleep(t *testing.T) {
+	f := NewFake(start)
+	woke := make(chan struct{})
+	go func() {
+		defer close(woke)
+		f.Sleep(time.Minute)
+	}()
+
+	// don't advance before the goroutine is asleep
+	f.BlockUntil(1)
+	f.Advance(time.Minute)
+
+	select {
+	case <-woke:
+	case <-time.After(time.Second):
+		t.Fatal("Sleep() didn't return once the clock was advanced")
+	}
+}
+
+func TestFakeFiresInOrder(t *testing.T) {
+	f := NewFake(start)
+	late, early := f.After(2*time.Second), f.After(time.Second)
+
+	f.Advance(time.Hour)
+
+	if got := <-early; !got.Equal(start.Add(time.Second)) {
+		t.Errorf("early got %v; want %v", got, start.Add(time.Second))
+	}
+	if got := <-late; !got.Equal(start.Add(2 * time.Second)) {
+		t.Errorf("late got %v; want %v", got, start.Add(2*time.Second))
+	}
+}
+
+func TestFakeTimerStop(t *testing.T) {
+	f := NewFake(start)
+	timer := f.NewTimer(time.Second)
+	ticker := f.NewTicker(time.Second)
+
+	if !timer.Stop() {
+		t.Error("Stop() of a pending timer got false; want true")
+	}
+	ticker.Stop()
+
+	// nothing waits on the clock any more
+	blocked := make(chan struct{})
+	go func() {
+		defer close(blocked)
+		f.BlockUntil(1)
+	}()
+	select {
+	case <-blocked:
+		t.Fatal("BlockUntil(1) counted a stopped timer or ticker")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	f.Advance(time.Hour)
+	select {
+	case <-timer.C():
+		t.Error("a stopped timer fired")
+	case <-ticker.C():
+		t.Error("a stopped ticker ticked")
+	default:
+	}
+
+	if timer.Stop() {
+		t.Error("Stop() of a stopped timer got true; want false")
+	}
+
+	// a new waiter unblocks BlockUntil
+	f.After(time.Second)
+	<-blocked
+}
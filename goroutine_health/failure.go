@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+// errWardTimeout is the failure of a ward that missed its heartbeat.
+var errWardTimeout = errors.New("ward missed its heartbeat")
+
+// wardError wraps a failure the way MyError does in error_propagation, with
+// the stack trace of where it was wrapped for investigation.
+type wardError struct {
+	Inner      error // error we are wrapping for investigation
+	Message    string
+	StackTrace string
+	Misc       map[string]interface{} // storing miscellaneous info
+}
+
+func wrapError(err error, messagef string, msgArgs ...interface{}) wardError {
+	return wardError{
+		Inner:      err,
+		Message:    fmt.Sprintf(messagef, msgArgs...),
+		StackTrace: string(debug.Stack()),
+		Misc:       make(map[string]interface{}),
+	}
+}
+
+// implementing the Error interface
+func (e wardError) Error() string {
+	return e.Message
+}
+
+func (e wardError) Unwrap() error {
+	return e.Inner
+}
+
+// A panicError is the failure of a ward that panicked with value, its stack
+// trace is the one of the goroutine that panicked when it comes from
+// recoverWard.
+type panicError struct {
+	wardError
+	value interface{}
+}
+
+func newPanicError(value interface{}) panicError {
+	err, _ := value.(error)
+	return panicError{wrapError(err, "ward panicked: %v", value), value}
+}
+
+// A gaveUpError is the failure a supervisor reports when it gives up on its
+// wards, err is why ward stopped the last time.
+type gaveUpError struct {
+	ward     string
+	restarts int
+	err      error
+}
+
+func (e gaveUpError) Error() string {
+	return fmt.Sprintf("gave up after %d restarts, %s stopped: %v", e.restarts, e.ward, e.err)
+}
+
+func (e gaveUpError) Unwrap() error {
+	return e.err
+}
+
+// failureKind is a class of ward failures.
+type failureKind int
+
+const (
+	// failureNone is no failure, the ward returned.
+	failureNone failureKind = iota
+	// failureTimeout is a ward that missed its heartbeat.
+	failureTimeout
+	// failurePanic is a ward that panicked.
+	failurePanic
+	// failureError is a ward that reported an error.
+	failureError
+	// failureGaveUp is a supervisor that gave up on its wards.
+	failureGaveUp
+)
+
+func (k failureKind) String() string {
+	switch k {
+	case failureNone:
+		return "none"
+	case failureTimeout:
+		return "timeout"
+	case failurePanic:
+		return "panic"
+	case failureError:
+		return "error"
+	case failureGaveUp:
+		return "gave up"
+	}
+	return fmt.Sprintf("failureKind(%d)", int(k))
+}
+
+// classify returns the kind of failure err is.
+func classify(err error) failureKind {
+	var panicErr panicError
+	var gaveUpErr gaveUpError
+	switch {
+	case err == nil:
+		return failureNone
+	// a supervisor that gave up is that even when its last ward panicked
+	case errors.As(err, &gaveUpErr):
+		return failureGaveUp
+	case errors.As(err, &panicErr):
+		return failurePanic
+	case errors.Is(err, errWardTimeout):
+		return failureTimeout
+	}
+	return failureError
+}
+
+// reportExit sends why a ward is about to return to its steward on the
+// ward's heartbeat. An error is sent as it is, anything else is taken for the
+// value of a panic. It gives up once done is closed.
+func reportExit(
+	done <-chan interface{},
+	heartbeat chan<- interface{},
+	reason interface{},
+) {
+	err, ok := reason.(error)
+	if !ok {
+		err = newPanicError(reason)
+	}
+
+	select {
+	case heartbeat <- err:
+	case <-done:
+	}
+}
+
+// recoverWard, when deferred by a ward's goroutine, turns a panic of the
+// goroutine into a failure reported to the steward on heartbeat, instead of
+// the end of the process. Only the goroutine that panics can recover, so
+// every goroutine of the ward needs its own.
+func recoverWard(done <-chan interface{}, heartbeat chan<- interface{}) {
+	if v := recover(); v != nil {
+		reportExit(done, heartbeat, newPanicError(v))
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// wardState is where a ward is in its life, as far as its supervisor knows.
+type wardState int
+
+const (
+	// wardRunning is a ward that was started and hasn't stopped since.
+	wardRunning wardState = iota
+	// wardRestarting is a ward that stopped and is about to be restarted,
+	// its supervisor may be backing off.
+	wardRestarting
+	// wardStopped is a ward that returned and is left stopped by the
+	// policy.
+	wardStopped
+	// wardGaveUp is a ward whose supervisor gave up.
+	wardGaveUp
+	// wardHalted is a ward whose supervisor was told to halt.
+	wardHalted
+)
+
+func (s wardState) String() string {
+	switch s {
+	case wardRunning:
+		return "running"
+	case wardRestarting:
+		return "restarting"
+	case wardStopped:
+		return "stopped"
+	case wardGaveUp:
+		return "gave up"
+	case wardHalted:
+		return "halted"
+	}
+	return fmt.Sprintf("wardState(%d)", int(s))
+}
+
+func (s wardState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// wardStatus is the health of a ward, it's what healthRegistry serves as
+// JSON.
+type wardStatus struct {
+	Name          string     `json:"name"`
+	State         wardState  `json:"state"`
+	Restarts      int        `json:"restarts"`
+	LastHeartbeat *time.Time `json:"last_heartbeat,omitempty"`
+	LastFailure   string     `json:"last_failure,omitempty"`
+	// the error LastFailure is the message of
+	lastFailure error
+}
+
+// A healthRegistry keeps the health of the wards of one or more supervisors
+// by name, the names have to be unique across the supervisors sharing it.
+// It's safe for concurrent use.
+type healthRegistry struct {
+	mu    sync.Mutex
+	wards map[string]*wardStatus
+}
+
+func newHealthRegistry() *healthRegistry {
+	return &healthRegistry{wards: make(map[string]*wardStatus)}
+}
+
+// ward returns the status of the ward called name, adding it if it's new.
+// r.mu must be held.
+func (r *healthRegistry) ward(name string) *wardStatus {
+	w, ok := r.wards[name]
+	if !ok {
+		w = &wardStatus{Name: name}
+		r.wards[name] = w
+	}
+	return w
+}
+
+func (r *healthRegistry) setState(name string, state wardState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.ward(name).State = state
+}
+
+func (r *healthRegistry) beat(name string, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.ward(name).LastHeartbeat = &at
+}
+
+func (r *healthRegistry) restarted(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w := r.ward(name)
+	w.State = wardRunning
+	w.Restarts++
+}
+
+func (r *healthRegistry) failed(name string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w := r.ward(name)
+	w.lastFailure = err
+	w.LastFailure = err.Error()
+}
+
+// lastFailure returns why the ward called name failed the last time, or nil
+// if it never did.
+func (r *healthRegistry) lastFailure(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if w, ok := r.wards[name]; ok {
+		return w.lastFailure
+	}
+	return nil
+}
+
+// status returns the health of every ward, sorted by name.
+func (r *healthRegistry) status() []wardStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	wards := make([]wardStatus, 0, len(r.wards))
+	for _, w := range r.wards {
+		wards = append(wards, *w)
+	}
+	sort.Slice(wards, func(i, j int) bool { return wards[i].Name < wards[j].Name })
+	return wards
+}
+
+// live reports whether no supervisor has given up on its wards, an
+// orchestrator should restart the process otherwise.
+func (r *healthRegistry) live() bool {
+	for _, w := range r.status() {
+		if w.State == wardGaveUp {
+			return false
+		}
+	}
+	return true
+}
+
+// ready reports whether every ward is running, or returned for good.
+func (r *healthRegistry) ready() bool {
+	for _, w := range r.status() {
+		if w.State != wardRunning && w.State != wardStopped {
+			return false
+		}
+	}
+	return true
+}
+
+// handler returns an http.Handler that serves the health of the wards as
+// JSON on /health, and probes on /health/live and /health/ready that answer
+// 200 when live or ready and 503 when not.
+func (r *healthRegistry) handler() http.Handler {
+	probe := func(ok func() bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, _ *http.Request) {
+			if !ok() {
+				http.Error(w, "not ok", http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprintln(w, "ok")
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Live  bool         `json:"live"`
+			Ready bool         `json:"ready"`
+			Wards []wardStatus `json:"wards"`
+		}{r.live(), r.ready(), r.status()})
+	})
+	mux.Handle("/health/live", probe(r.live))
+	mux.Handle("/health/ready", probe(r.ready))
+	return mux
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Lumexralph/Concurrency-with-Go/clock"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHealthRegistry(t *testing.T) {
+	r := newHealthRegistry()
+	at := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	r.setState("b", wardRunning)
+	r.setState("a", wardRunning)
+	r.beat("a", at)
+	if !r.live() || !r.ready() {
+		t.Errorf("registry of running wards got live %t and ready %t; want both", r.live(), r.ready())
+	}
+
+	errBoom := errors.New("boom")
+	r.failed("b", errBoom)
+	r.setState("b", wardRestarting)
+	if !r.live() || r.ready() {
+		t.Errorf("registry of a restarting ward got live %t and ready %t; want live only", r.live(), r.ready())
+	}
+
+	r.restarted("b")
+	want := []wardStatus{
+		{Name: "a", State: wardRunning, LastHeartbeat: &at},
+		{Name: "b", State: wardRunning, Restarts: 1, LastFailure: "boom", lastFailure: errBoom},
+	}
+	if got := r.status(); !reflect.DeepEqual(got, want) {
+		t.Errorf("status() got %+v; want %+v", got, want)
+	}
+	if got := r.lastFailure("b"); got != errBoom {
+		t.Errorf("lastFailure() got %v; want %v", got, errBoom)
+	}
+
+	r.setState("a", wardGaveUp)
+	if r.live() || r.ready() {
+		t.Errorf("registry of a ward given up on got live %t and ready %t; want neither", r.live(), r.ready())
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	r := newHealthRegistry()
+	r.setState("a", wardRunning)
+	r.setState("b", wardRestarting)
+	r.failed("b", errWardTimeout)
+
+	server := httptest.NewServer(r.handler())
+	defer server.Close()
+
+	get := func(path string) *http.Response {
+		t.Helper()
+
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s got err %v", path, err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	resp := get("/health")
+	var got struct {
+		Live, Ready bool
+		Wards       []map[string]interface{}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("GET /health got invalid JSON: %v", err)
+	}
+	if !got.Live || got.Ready || len(got.Wards) != 2 {
+		t.Fatalf("GET /health got %+v; want live, not ready, with 2 wards", got)
+	}
+	if state := got.Wards[1]["state"]; state != "restarting" {
+		t.Errorf("GET /health got state %v for b; want restarting", state)
+	}
+	if failure := got.Wards[1]["last_failure"]; failure != errWardTimeout.Error() {
+		t.Errorf("GET /health got last failure %v for b; want %v", failure, errWardTimeout)
+	}
+	if _, ok := got.Wards[0]["last_heartbeat"]; ok {
+		t.Errorf("GET /health got a last heartbeat for a; want none")
+	}
+
+	for path, want := range map[string]int{
+		"/health/live":  http.StatusOK,
+		"/health/ready": http.StatusServiceUnavailable,
+	} {
+		if got := get(path).StatusCode; got != want {
+			t.Errorf("GET %s got status %d; want %d", path, got, want)
+		}
+	}
+}
+
+func TestSupervisorHealth(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+
+	// a ward that pulses once then returns
+	ward := func(done <-chan interface{}, _ time.Duration) <-chan interface{} {
+		heartbeat := make(chan interface{})
+		go func() {
+			defer close(heartbeat)
+			select {
+			case heartbeat <- struct{}{}:
+			case <-done:
+			}
+		}()
+		return heartbeat
+	}
+
+	s := newSupervisor(clk, time.Second, restartPolicy{maxRestarts: 1}, ward)
+	events := make(chan supervisorEvent, 100)
+	s.onEvent = func(e supervisorEvent) { events <- e }
+
+	done := make(chan interface{})
+	defer close(done)
+	heartbeat := s.start(done, time.Hour)
+
+	expect(t, events, "the ward to restart")
+	expect(t, events, "the supervisor to give up")
+	for range heartbeat {
+	}
+
+	got := s.health.status()
+	want := []wardStatus{{Name: "ward", State: wardGaveUp, Restarts: 1, LastHeartbeat: &start}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("status() got %+v; want %+v", got, want)
+	}
+	if s.health.live() {
+		t.Error("live() got true after the supervisor gave up; want false")
+	}
+}
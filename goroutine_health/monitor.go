@@ -5,8 +5,11 @@ package main
 
 import (
 	"fmt"
+	"github.com/Lumexralph/Concurrency-with-Go/clock"
+	"github.com/Lumexralph/Concurrency-with-Go/patterns"
 	"log"
 	"os"
+	"sync"
 	"time"
 )
 
@@ -15,110 +18,83 @@ type startGoroutineFn func(
 	pulseInterval time.Duration,
 ) (heartbeat <-chan interface{})
 
+// newSteward returns a function that starts a steward for the goroutines
+// startGoroutine starts, the ward is restarted whenever it misses a pulse for
+// timeout on clk.
 func newSteward(
+	clk clock.Clock,
 	timeout time.Duration,
 	startGoroutine startGoroutineFn,
 ) startGoroutineFn {
-	return func(
-		done <-chan interface{},
-		pulseInterval time.Duration,
-	) <-chan interface{} {
-		heartbeat := make(chan interface{})
-		go func() {
-			defer close(heartbeat)
+	// the zero policy restarts the ward every time, forever
+	return newSupervisor(clk, timeout, restartPolicy{}, startGoroutine).start
+}
 
-			var wardDone chan interface{}
-			var wardHearbeat <-chan interface{}
-			// create a closure to encode a way to start goroutine
-			// being monitored
-			startWard := func() {
-				// create a channel that gets passed to the ward
-				// goroutine in case we want to signal it to be stopped
-				wardDone = make(chan interface{})
-				// start the goroutine to be monitored
-				// to make the ward goroutine halt if either the
-				// steward goroutine is halted or the steward halts
-				// the ward goroutine, an or-channel is used to wrap
-				// both done channels
-				wardHearbeat = startGoroutine(or(wardDone, done), timeout/2)
-			}
-			startWard()
-			pulse := time.Tick(pulseInterval)
+// deliveryMode is how a ward of doWorkFn resumes after a restart.
+type deliveryMode int
+
+const (
+	// atLeastOnce checkpoints where the ward is on every pulse, a restarted
+	// ward sends again the values delivered since the last checkpoint.
+	atLeastOnce deliveryMode = iota
+	// exactlyOnce moves the cursor on with each value delivered and makes a
+	// restarted ward wait for the one before it to be done with the bridge,
+	// no value is sent twice.
+	exactlyOnce
+)
 
-		monitorLoop:
-			for {
-				timeoutSignal := time.After(timeout)
-				// loop ensures the steward can send out pulses of its own
-				for {
-					select {
-					case <-pulse:
-						select {
-						case heartbeat <- struct{}{}:
-						default:
-						}
-					// receive the ward's pulse
-					case <-wardHearbeat:
-						continue monitorLoop
-					// if we don't receive a pulse from the ward
-					// within the set timeout, kill the ward goroutine
-					// and restart a new ward goroutine
-					case <-timeoutSignal:
-						log.Println("steward: ward is unhealthy; restarting...")
-						close(wardDone)
-						startWard()
-						continue monitorLoop
-					case <-done:
-						log.Println("steward: I am halting.")
-						return
-					}
-				}
-			}
-		}()
-		return heartbeat
+func (m deliveryMode) String() string {
+	switch m {
+	case atLeastOnce:
+		return "at least once"
+	case exactlyOnce:
+		return "exactly once"
 	}
+	return fmt.Sprintf("deliveryMode(%d)", int(m))
 }
 
-// takes variadic argument of channels and pack it into a slice
-// var or func(channels ...<-chan interface{}) <-chan interface{}
-func or(channels ...<-chan interface{}) <-chan interface{} {
-	// base index
-	switch len(channels) {
-	case 0:
-		return nil
-	case 1:
-		return channels[0]
-	}
+// A cursor is where in intList the next ward resumes, it's kept on the
+// steward side of doWorkFn so it outlives the wards.
+type cursor struct {
+	mu sync.Mutex
+	// the number of values delivered, intList is repeated
+	pos int
+}
 
-	orDone := make(chan interface{})
-	go func() {
-		defer close(orDone)
+func (c *cursor) load() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-		switch len(channels) {
-		case 2:
-			select {
-			case <-channels[0]:
-			case <-channels[1]:
-			}
-		default:
-			select {
-			case <-channels[0]:
-			case <-channels[1]:
-			case <-channels[2]:
-			// recursively create an or-channel from all the channels
-			case <-or(append(channels[3:], orDone)...):
-			}
-		}
-	}()
-	return orDone
+	return c.pos
+}
+
+func (c *cursor) store(pos int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pos = pos
 }
 
 func doWorkFn(
+	clk clock.Clock,
 	done <-chan interface{},
+	mode deliveryMode,
 	intList ...int,
 ) (startGoroutineFn, <-chan interface{}) {
 	intChanStream := make(chan (<-chan interface{}))
-	intStream := bridge(done, intChanStream)
+	intStream := patterns.Bridge(done, intChanStream)
+	return intWard(clk, mode, new(cursor), intChanStream, intList...), intStream
+}
 
+// intWard returns the ward of doWorkFn, each ward it starts sends its stream
+// of intList on intChanStream and resumes from resume.
+func intWard(
+	clk clock.Clock,
+	mode deliveryMode,
+	resume *cursor,
+	intChanStream chan<- (<-chan interface{}),
+	intList ...int,
+) startGoroutineFn {
 	// ward -
 	doWork := func(
 		done <-chan interface{},
@@ -130,121 +106,76 @@ func doWorkFn(
 
 		go func() {
 			defer close(intStream)
+			defer recoverWard(done, hearbeat)
 
+			next := resume.load()
 			select {
 			// let bridge know the channel we'll be communicating on.
 			case intChanStream <- intStream:
 			case <-done:
 				return
 			}
-
-			pulse := time.Tick(pulseInterval)
-
-			for {
-			valueLoop:
-				for _, intVal := range intList {
-					// simulate an unhealthy ward when negative value is seen
-					if intVal < 0 {
-						log.Printf("negative value: %d\n", intVal)
-						return
-					}
-
-					for {
-						select {
-						case <-pulse:
-							select {
-							case hearbeat <- struct{}{}:
-							default:
-							}
-						case intStream <- intVal:
-							continue valueLoop
-						case <-done:
-							return
-						}
-					}
-				}
+			// bridge only takes this stream once the previous ward's is
+			// closed, the cursor won't move on behind our back now
+			if mode == exactlyOnce {
+				next = resume.load()
 			}
-		}()
-		return hearbeat
-	}
-	return doWork, intStream
-}
 
-// it helps destructuring a channel of channels into a single channel
-func bridge(
-	done <-chan interface{},
-	chanStream <-chan <-chan interface{},
-) <-chan interface{} {
-	// single channel to return all values
-	// from the stream of channels
-	valStream := make(chan interface{})
-	go func() {
-		defer close(valStream)
-		// pull values(chan) of the stream of channels
-		for {
-			var stream <-chan interface{}
-			select {
-			case maybeStream, ok := <-chanStream:
-				if ok == false {
-					return
+			ticker := clk.NewTicker(pulseInterval)
+			defer ticker.Stop()
+			pulse := ticker.C()
+			sendPulse := func() {
+				select {
+				case hearbeat <- struct{}{}:
+				default:
 				}
-				stream = maybeStream
-			case <-done:
-				return
 			}
 
-			for val := range orDone(done, stream) {
+			// nothing to send, just stay healthy
+			for len(intList) == 0 {
 				select {
-				case valStream <- val:
+				case <-pulse:
+					sendPulse()
 				case <-done:
+					return
 				}
 			}
-		}
-	}()
-	return valStream
-}
 
-func orDone(done, c <-chan interface{}) <-chan interface{} {
-	valStream := make(chan interface{})
-	go func() {
-		defer close(valStream)
-		for {
-			select {
-			case <-done:
-				return
-			case v, ok := <-c:
-				// if channel has been closed
-				if ok == false {
+		valueLoop:
+			for ; ; next++ {
+				intVal := intList[next%len(intList)]
+				// simulate a failing ward when negative value is seen,
+				// it tells the steward why so it's restarted at once. The
+				// value is skipped, or the restarted ward would fail on
+				// it again
+				if intVal < 0 {
+					log.Printf("negative value: %d\n", intVal)
+					resume.store(next + 1)
+					reportExit(done, hearbeat, fmt.Errorf("negative value: %d", intVal))
 					return
 				}
-				// continue reading value from the channel
-				select {
-				case valStream <- v:
-				case <-done:
-				}
-			}
-		}
-	}()
-	return valStream
-}
 
-func take(
-	done <-chan interface{},
-	valueStream <-chan interface{},
-	num int,
-) <-chan interface{} {
-	funcStream := make(chan interface{})
-	go func() {
-		defer close(funcStream)
-		for i := num; i > 0 || i == -1; i-- {
-			select {
-			case <-done:
-				return
-			case funcStream <- <-valueStream:
+				for {
+					select {
+					case <-pulse:
+						if mode == atLeastOnce {
+							resume.store(next)
+						}
+						sendPulse()
+					case intStream <- intVal:
+						if mode == exactlyOnce {
+							resume.store(next + 1)
+						}
+						continue valueLoop
+					case <-done:
+						return
+					}
+				}
 			}
-		}
-	}()
-	return funcStream
+		}()
+		return hearbeat
+	}
+	return doWork
 }
 
 // the monitoring system
@@ -255,14 +186,15 @@ func main() {
 	done := make(chan interface{})
 	defer close(done)
 
+	clk := clock.New()
 	// create the ward
-	doWork, intStream := doWorkFn(done, 3, 2, 1, 0, -1, 2, -3, 4, 3, 2, 1)
+	doWork, intStream := doWorkFn(clk, done, exactlyOnce, 3, 2, 1, 0, -1, 2, -3, 4, 3, 2, 1)
 	// create the steward
-	monitorWithSteward := newSteward(1*time.Millisecond, doWork)
+	monitorWithSteward := newSteward(clk, 1*time.Millisecond, doWork)
 	// start the ward and start monitoring
 	monitorWithSteward(done, 1*time.Hour)
 
-	for intVal := range take(done, intStream, 6) {
+	for intVal := range patterns.Take(done, intStream, 6) {
 		fmt.Printf("main: received - %d\n", intVal)
 	}
 }
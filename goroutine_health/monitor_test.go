@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"github.com/Lumexralph/Concurrency-with-Go/clock"
+	"github.com/Lumexralph/Concurrency-with-Go/patterns"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStewardRestartsUnhealthyWard(t *testing.T) {
+	clk := clock.NewFake(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	// a ward that never pulses, it only reports each time it's started
+	starts := make(chan struct{})
+	ward := func(done <-chan interface{}, _ time.Duration) <-chan interface{} {
+		starts <- struct{}{}
+		return nil
+	}
+
+	done := make(chan interface{})
+	heartbeat := newSteward(clk, time.Second, ward)(done, time.Hour)
+	<-starts
+
+	for i := 0; i < 3; i++ {
+		// the steward's pulse and its timeout for the ward
+		clk.BlockUntil(2)
+		clk.Advance(time.Second)
+
+		select {
+		case <-starts:
+		case <-time.After(time.Second):
+			t.Fatalf("steward did not restart the ward on timeout %d", i+1)
+		}
+	}
+
+	close(done)
+	for range heartbeat {
+	}
+}
+
+func TestStewardKeepsHealthyWard(t *testing.T) {
+	clk := clock.NewFake(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	done := make(chan interface{})
+	defer close(done)
+
+	doWork, intStream := doWorkFn(clk, done, exactlyOnce, 1, 2, 3)
+	newSteward(clk, time.Second, doWork)(done, time.Hour)
+
+	var got []int
+	for v := range patterns.Take(done, intStream, 6) {
+		got = append(got, v.(int))
+	}
+
+	want := []int{1, 2, 3, 1, 2, 3}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("steward with a healthy ward got %v; want %v", got, want)
+		}
+	}
+}
+
+func TestDoWorkFnResumes(t *testing.T) {
+	tests := []struct {
+		mode deliveryMode
+		want []int
+	}{
+		// the ward fails on -1 and the steward restarts it, it carries on
+		// after -1 instead of going back to 1
+		{mode: exactlyOnce, want: []int{1, 2, 3, 4, 5, 1, 2, 3, 4, 5}},
+		{mode: atLeastOnce, want: []int{1, 2, 3, 4, 5, 1, 2, 3, 4, 5}},
+	}
+
+	for _, tc := range tests {
+		t.Run(fmt.Sprint(tc.mode), func(t *testing.T) {
+			clk := clock.NewFake(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+			done := make(chan interface{})
+			defer close(done)
+
+			doWork, intStream := doWorkFn(clk, done, tc.mode, 1, 2, 3, -1, 4, 5)
+			newSteward(clk, time.Second, doWork)(done, time.Hour)
+
+			var got []int
+			for v := range patterns.Take(done, intStream, len(tc.want)) {
+				got = append(got, v.(int))
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("steward with a failing ward got %v; want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDoWorkFnRestartedWard(t *testing.T) {
+	tests := []struct {
+		mode deliveryMode
+		want []int
+	}{
+		// nothing was checkpointed, so the new ward starts over from 1
+		{mode: atLeastOnce, want: []int{1, 2, 1, 2, 3}},
+		// the new ward carries on after the last value delivered
+		{mode: exactlyOnce, want: []int{1, 2, 3, 4, 5}},
+	}
+
+	for _, tc := range tests {
+		t.Run(fmt.Sprint(tc.mode), func(t *testing.T) {
+			clk := clock.NewFake(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+			done := make(chan interface{})
+			defer close(done)
+
+			// the streams are read straight from the wards rather than
+			// through a bridge, so no value is taken from the first ward
+			// after its second one
+			intChanStream := make(chan (<-chan interface{}))
+			doWork := intWard(clk, tc.mode, new(cursor), intChanStream, 1, 2, 3, 4, 5)
+
+			wardDone := make(chan interface{})
+			doWork(wardDone, time.Hour)
+			first := <-intChanStream
+			got := []int{(<-first).(int), (<-first).(int)}
+
+			// the ward can only stop now, nobody ever takes its third value
+			close(wardDone)
+
+			doWork(done, time.Hour)
+			second := <-intChanStream
+			for len(got) < len(tc.want) {
+				got = append(got, (<-second).(int))
+			}
+
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("restarted ward delivering %v got %v; want %v", tc.mode, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDoWorkFnCheckpoints(t *testing.T) {
+	clk := clock.NewFake(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	done := make(chan interface{})
+	defer close(done)
+
+	doWork, intStream := doWorkFn(clk, done, atLeastOnce, 1, 2, 3, 4, 5)
+
+	wardDone := make(chan interface{})
+	heartbeat := doWork(wardDone, time.Second)
+	got := []int{(<-intStream).(int), (<-intStream).(int)}
+
+	// the ward checkpoints before it pulses, pulses are dropped when
+	// nobody's listening so keep the clock going until one gets through.
+	// The bridge may be holding 3 already.
+	clk.BlockUntil(1)
+	for pulsed := false; !pulsed; {
+		clk.Advance(time.Second)
+		select {
+		case <-heartbeat:
+			pulsed = true
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	close(wardDone)
+	doWork(done, time.Second)
+
+	for i := 0; i < 2; i++ {
+		got = append(got, (<-intStream).(int))
+	}
+	if got[2] == 1 {
+		t.Errorf("ward restarted after a checkpoint got %v; want it not to start over", got)
+	}
+}
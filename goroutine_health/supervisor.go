@@ -0,0 +1,467 @@
+package main
+
+import (
+	"fmt"
+	"github.com/Lumexralph/Concurrency-with-Go/clock"
+	"github.com/Lumexralph/Concurrency-with-Go/patterns"
+	"log"
+	"math"
+	"time"
+)
+
+// restartMode says which kind of stop makes a supervisor restart its ward.
+type restartMode int
+
+const (
+	// restartAlways restarts the ward however it stopped.
+	restartAlways restartMode = iota
+	// restartOnFailure restarts the ward only when it failed, by missing its
+	// heartbeat or reporting why it exits, a ward that just returns (closes
+	// its heartbeat) is left stopped.
+	restartOnFailure
+)
+
+// restartPolicy is how a supervisor restarts its ward and when it gives up.
+type restartPolicy struct {
+	mode restartMode
+	// maxRestarts is how many restarts are allowed within window before the
+	// supervisor gives up, 0 means there's no limit. A window of 0 counts
+	// every restart since the supervisor started.
+	maxRestarts int
+	window      time.Duration
+	// backoff is how long the supervisor waits before restarting the ward, it
+	// doubles with each restart already made in the window and never goes
+	// beyond maxBackoff, if maxBackoff is set.
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+// delay returns how long to wait before the next restart given the number of
+// restarts already made in the window.
+func (p restartPolicy) delay(restarts int) time.Duration {
+	d := p.backoff
+	for i := 0; i < restarts && d > 0 && d < math.MaxInt64/2; i++ {
+		if p.maxBackoff > 0 && d >= p.maxBackoff {
+			break
+		}
+		d *= 2
+	}
+	if p.maxBackoff > 0 && d > p.maxBackoff {
+		d = p.maxBackoff
+	}
+	return d
+}
+
+type eventKind int
+
+const (
+	// eventRestart is sent each time the ward is restarted.
+	eventRestart eventKind = iota
+	// eventExit is sent when the ward returned and the policy doesn't
+	// restart it, the supervisor stops with it.
+	eventExit
+	// eventGaveUp is sent when the ward stopped once too often for the
+	// policy, the supervisor stops for good.
+	eventGaveUp
+)
+
+func (k eventKind) String() string {
+	switch k {
+	case eventRestart:
+		return "restart"
+	case eventExit:
+		return "exit"
+	case eventGaveUp:
+		return "gave up"
+	}
+	return fmt.Sprintf("eventKind(%d)", int(k))
+}
+
+// A supervisorEvent tells what a supervisor did with its wards.
+type supervisorEvent struct {
+	kind eventKind
+	// ward is the name of the ward that stopped and caused the event.
+	ward string
+	// reason is why the ward stopped, nil when it returned.
+	reason error
+	at     time.Time
+	// restarts is the number of restarts made within the policy's window,
+	// this one included.
+	restarts int
+}
+
+// strategy says which wards a supervisor restarts when one of them stops.
+type strategy int
+
+const (
+	// oneForOne restarts only the ward that stopped.
+	oneForOne strategy = iota
+	// oneForAll stops every other ward and restarts them all.
+	oneForAll
+	// restForOne stops the wards started after the one that stopped and
+	// restarts it and them, for wards that depend on the ones before them.
+	restForOne
+)
+
+func (st strategy) String() string {
+	switch st {
+	case oneForOne:
+		return "one for one"
+	case oneForAll:
+		return "one for all"
+	case restForOne:
+		return "rest for one"
+	}
+	return fmt.Sprintf("strategy(%d)", int(st))
+}
+
+// affected returns, in start order, the indexes of the n wards to restart
+// when ward i stops.
+func (st strategy) affected(i, n int) []int {
+	var first, last int
+	switch st {
+	case oneForAll:
+		first, last = 0, n
+	case restForOne:
+		first, last = i, n
+	default:
+		first, last = i, i+1
+	}
+
+	indexes := make([]int, 0, last-first)
+	for j := first; j < last; j++ {
+		indexes = append(indexes, j)
+	}
+	return indexes
+}
+
+// A namedWard is a ward of a supervisor, another supervisor's start makes
+// one too, so supervisors can be nested into a tree.
+type namedWard struct {
+	name  string
+	start startGoroutineFn
+}
+
+// A supervisor is a steward with a restartPolicy for any number of wards, a
+// ward is restarted when it misses a heartbeat for timeout, reports why it
+// exits with reportExit or returns, and the policy allows it. The strategy
+// picks which of the other wards are restarted with it, and the policy's
+// limit counts the restarts of all the wards together.
+type supervisor struct {
+	clk      clock.Clock
+	timeout  time.Duration
+	policy   restartPolicy
+	strategy strategy
+	wards    []namedWard
+	// onEvent, if set, is called from the supervisor's goroutine with every
+	// event, it must not block.
+	onEvent func(supervisorEvent)
+	// health is kept up to date with the state of the wards, set it before
+	// start to share a registry between supervisors.
+	health *healthRegistry
+}
+
+// newSupervisor returns a supervisor with a single ward.
+func newSupervisor(
+	clk clock.Clock,
+	timeout time.Duration,
+	policy restartPolicy,
+	ward startGoroutineFn,
+) *supervisor {
+	return newTreeSupervisor(clk, timeout, policy, oneForOne, namedWard{"ward", ward})
+}
+
+// newTreeSupervisor returns a supervisor of wards that are started in order.
+func newTreeSupervisor(
+	clk clock.Clock,
+	timeout time.Duration,
+	policy restartPolicy,
+	strategy strategy,
+	wards ...namedWard,
+) *supervisor {
+	return &supervisor{
+		clk:      clk,
+		timeout:  timeout,
+		policy:   policy,
+		strategy: strategy,
+		wards:    wards,
+		health:   newHealthRegistry(),
+	}
+}
+
+// lastFailure returns why the ward called name failed the last time, or nil
+// if it never did.
+func (s *supervisor) lastFailure(name string) error {
+	return s.health.lastFailure(name)
+}
+
+// setStates sets the state of all the wards in the health registry.
+func (s *supervisor) setStates(state wardState) {
+	for _, w := range s.wards {
+		s.health.setState(w.name, state)
+	}
+}
+
+// A wardStop is sent by the goroutine watching a ward when the ward missed a
+// heartbeat, reported a failure or returned.
+type wardStop struct {
+	index int
+	// done identifies the run of the ward, stops of an earlier run are
+	// ignored
+	done chan interface{}
+	// reason is why the ward failed, nil if it returned
+	reason error
+}
+
+// start is a startGoroutineFn, it starts the wards and supervises them until
+// done is closed or the supervisor stops, which closes the heartbeat it
+// returns.
+func (s *supervisor) start(
+	done <-chan interface{},
+	pulseInterval time.Duration,
+) <-chan interface{} {
+	heartbeat := make(chan interface{})
+	go func() {
+		defer close(heartbeat)
+		// a panic of the supervisor itself, say in onEvent, is its own
+		// failure for its steward to handle
+		defer recoverWard(done, heartbeat)
+
+		stopped := make(chan wardStop)
+		// the done channel of each running ward, nil once it's stopped
+		running := make([]chan interface{}, len(s.wards))
+		startWard := func(i int) {
+			wardDone := make(chan interface{})
+			running[i] = wardDone
+			wardHeartbeat, err := s.safeStart(i, patterns.Or(wardDone, done))
+			if err != nil {
+				stop := wardStop{index: i, done: wardDone, reason: err}
+				go func() {
+					select {
+					case stopped <- stop:
+					case <-wardDone:
+					}
+				}()
+				return
+			}
+			go s.watch(i, wardDone, wardHeartbeat, stopped)
+		}
+		stopWard := func(i int) {
+			if running[i] != nil {
+				close(running[i])
+				running[i] = nil
+			}
+		}
+		// stop the wards the other way round to how they were started
+		stopAll := func() {
+			for i := len(running) - 1; i >= 0; i-- {
+				stopWard(i)
+			}
+		}
+		defer stopAll()
+
+		for i, w := range s.wards {
+			s.health.setState(w.name, wardRunning)
+			startWard(i)
+		}
+
+		ticker := s.clk.NewTicker(pulseInterval)
+		defer ticker.Stop()
+		pulse := ticker.C()
+		sendPulse := func() {
+			select {
+			case heartbeat <- struct{}{}:
+			default:
+			}
+		}
+
+		// restarts made within the policy's window, oldest first
+		var restarts []time.Time
+
+		for {
+			var stop wardStop
+			select {
+			case <-pulse:
+				sendPulse()
+				continue
+			case <-done:
+				log.Println("steward: I am halting.")
+				s.setStates(wardHalted)
+				return
+			case stop = <-stopped:
+			}
+			if running[stop.index] != stop.done {
+				continue
+			}
+			stopWard(stop.index)
+
+			name := s.wards[stop.index].name
+			now := s.clk.Now()
+			if stop.reason != nil {
+				s.health.failed(name, stop.reason)
+			}
+
+			if stop.reason == nil && s.policy.mode == restartOnFailure {
+				log.Printf("steward: %s has returned.\n", name)
+				s.health.setState(name, wardStopped)
+				s.notify(supervisorEvent{kind: eventExit, ward: name, at: now, restarts: len(restarts)})
+				if s.stopped(running) {
+					log.Println("steward: all wards have returned; halting.")
+					return
+				}
+				continue
+			}
+
+			if s.policy.window > 0 {
+				for len(restarts) > 0 && now.Sub(restarts[0]) >= s.policy.window {
+					restarts = restarts[1:]
+				}
+			}
+			if s.policy.maxRestarts > 0 && len(restarts) >= s.policy.maxRestarts {
+				log.Printf("steward: wards restarted %d times; giving up.\n", len(restarts))
+				s.notify(supervisorEvent{
+					kind:     eventGaveUp,
+					ward:     name,
+					reason:   stop.reason,
+					at:       now,
+					restarts: len(restarts),
+				})
+				// stop the wards first, a parent may take its time to
+				// read why its ward stopped
+				stopAll()
+				s.setStates(wardGaveUp)
+				reportExit(done, heartbeat, gaveUpError{ward: name, restarts: len(restarts), err: stop.reason})
+				return
+			}
+
+			// the ward that stopped, and those of the others that are still
+			// running, a ward that returned for good stays stopped
+			var restart []int
+			for _, i := range s.strategy.affected(stop.index, len(s.wards)) {
+				if i == stop.index || running[i] != nil {
+					restart = append(restart, i)
+				}
+			}
+			for j := len(restart) - 1; j >= 0; j-- {
+				stopWard(restart[j])
+				s.health.setState(s.wards[restart[j]].name, wardRestarting)
+			}
+
+			// keep pulsing while backing off, the supervisor is healthy
+			// even if its wards aren't
+			if d := s.policy.delay(len(restarts)); d > 0 {
+				backoff := s.clk.NewTimer(d)
+			backoffLoop:
+				for {
+					select {
+					case <-pulse:
+						sendPulse()
+					case <-backoff.C():
+						break backoffLoop
+					case <-done:
+						backoff.Stop()
+						log.Println("steward: I am halting.")
+						s.setStates(wardHalted)
+						return
+					}
+				}
+			}
+
+			switch classify(stop.reason) {
+			case failureNone:
+				log.Printf("steward: %s has returned; restarting...\n", name)
+			case failureTimeout:
+				log.Printf("steward: %s is unhealthy; restarting...\n", name)
+			default:
+				log.Printf("steward: %s failed: %v; restarting...\n", name, stop.reason)
+			}
+			restarts = append(restarts, s.clk.Now())
+			for _, i := range restart {
+				s.health.restarted(s.wards[i].name)
+				startWard(i)
+			}
+			s.notify(supervisorEvent{
+				kind:     eventRestart,
+				ward:     name,
+				reason:   stop.reason,
+				at:       s.clk.Now(),
+				restarts: len(restarts),
+			})
+		}
+	}()
+	return heartbeat
+}
+
+// safeStart starts ward i, a panic of its start function is returned as a
+// panicError.
+func (s *supervisor) safeStart(
+	i int,
+	done <-chan interface{},
+) (heartbeat <-chan interface{}, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = newPanicError(v)
+		}
+	}()
+	return s.wards[i].start(done, s.timeout/2), nil
+}
+
+// watch sends a wardStop on stopped when the ward misses a heartbeat for the
+// timeout, reports a failure or returns, unless wardDone is closed first.
+func (s *supervisor) watch(
+	i int,
+	wardDone chan interface{},
+	wardHeartbeat <-chan interface{},
+	stopped chan<- wardStop,
+) {
+	stop := wardStop{index: i, done: wardDone}
+
+	// the timer is stopped rather than left behind whenever it's re-armed,
+	// so a fake clock only ever sees the one that's waited on
+	timeout := s.clk.NewTimer(s.timeout)
+	defer func() { timeout.Stop() }()
+
+	for {
+		select {
+		// receive the ward's pulse
+		case pulse, ok := <-wardHeartbeat:
+			if err, failed := pulse.(error); failed {
+				stop.reason = err
+				break
+			}
+			if ok {
+				s.health.beat(s.wards[i].name, s.clk.Now())
+				timeout.Stop()
+				timeout = s.clk.NewTimer(s.timeout)
+				continue
+			}
+			// the ward returned
+		case <-timeout.C():
+			stop.reason = errWardTimeout
+		case <-wardDone:
+			return
+		}
+		break
+	}
+
+	select {
+	case stopped <- stop:
+	case <-wardDone:
+	}
+}
+
+// stopped reports whether none of the wards is running.
+func (s *supervisor) stopped(running []chan interface{}) bool {
+	for _, wardDone := range running {
+		if wardDone != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *supervisor) notify(e supervisorEvent) {
+	if s.onEvent != nil {
+		s.onEvent(e)
+	}
+}
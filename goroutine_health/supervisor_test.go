@@ -0,0 +1,513 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Lumexralph/Concurrency-with-Go/clock"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countingWard returns a ward that never pulses and sends on starts each time
+// it's started, if exit is set the ward returns straight away.
+func countingWard(starts chan<- struct{}, exit bool) startGoroutineFn {
+	return func(done <-chan interface{}, _ time.Duration) <-chan interface{} {
+		starts <- struct{}{}
+		heartbeat := make(chan interface{})
+		if exit {
+			close(heartbeat)
+		}
+		return heartbeat
+	}
+}
+
+// expect fails t unless ch gets a value soon.
+func expect[T any](t *testing.T, ch <-chan T, what string) T {
+	t.Helper()
+
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+	panic("unreachable")
+}
+
+// expectNothing fails t if ch gets a value soon.
+func expectNothing[T any](t *testing.T, ch <-chan T, what string) {
+	t.Helper()
+
+	select {
+	case v := <-ch:
+		t.Fatalf("got %s %v; want nothing", what, v)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func newTestSupervisor(
+	policy restartPolicy,
+	ward startGoroutineFn,
+) (*clock.Fake, *supervisor, <-chan supervisorEvent) {
+	clk := clock.NewFake(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	events := make(chan supervisorEvent, 100)
+	s := newSupervisor(clk, time.Second, policy, ward)
+	s.onEvent = func(e supervisorEvent) { events <- e }
+	return clk, s, events
+}
+
+func TestRestartPolicyDelay(t *testing.T) {
+	p := restartPolicy{backoff: time.Second, maxBackoff: 5 * time.Second}
+	for restarts, want := range []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second,
+	} {
+		if got := p.delay(restarts); got != want {
+			t.Errorf("delay(%d) got %v; want %v", restarts, got, want)
+		}
+	}
+
+	if got := (restartPolicy{backoff: time.Second}).delay(1000); got <= 0 {
+		t.Errorf("delay(1000) without a maximum got %v; want it to stay positive", got)
+	}
+}
+
+func TestSupervisorGivesUp(t *testing.T) {
+	starts := make(chan struct{}, 100)
+	policy := restartPolicy{maxRestarts: 2, window: time.Minute}
+	clk, s, events := newTestSupervisor(policy, countingWard(starts, false))
+
+	done := make(chan interface{})
+	defer close(done)
+	heartbeat := s.start(done, time.Hour)
+	expect(t, starts, "the ward to start")
+
+	for i := 1; i <= 2; i++ {
+		clk.BlockUntil(2)
+		clk.Advance(time.Second)
+		expect(t, starts, "the ward to restart")
+		if e := expect(t, events, "an event"); e.kind != eventRestart || e.restarts != i {
+			t.Errorf("got event %v after %d restarts; want %v", e.kind, e.restarts, eventRestart)
+		}
+	}
+
+	clk.BlockUntil(2)
+	clk.Advance(time.Second)
+	if e := expect(t, events, "an event"); e.kind != eventGaveUp || e.restarts != 2 {
+		t.Errorf("got event %v after %d restarts; want %v after 2", e.kind, e.restarts, eventGaveUp)
+	}
+	for range heartbeat {
+	}
+	expectNothing(t, starts, "a ward start")
+}
+
+func TestSupervisorWindow(t *testing.T) {
+	// the ward times out every second, so with a window of a second each
+	// restart is forgotten by the time of the next one
+	tests := []struct {
+		window time.Duration
+		want   []eventKind
+	}{
+		{window: time.Second, want: []eventKind{eventRestart, eventRestart, eventRestart, eventRestart}},
+		{window: 2 * time.Second, want: []eventKind{eventRestart, eventGaveUp}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.window.String(), func(t *testing.T) {
+			starts := make(chan struct{}, 100)
+			policy := restartPolicy{maxRestarts: 1, window: tc.window}
+			clk, s, events := newTestSupervisor(policy, countingWard(starts, false))
+
+			done := make(chan interface{})
+			defer close(done)
+			s.start(done, time.Hour)
+
+			for _, want := range tc.want {
+				clk.BlockUntil(2)
+				clk.Advance(time.Second)
+				if e := expect(t, events, "an event"); e.kind != want {
+					t.Fatalf("got event %v; want %v", e.kind, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSupervisorBackoff(t *testing.T) {
+	starts := make(chan struct{}, 100)
+	policy := restartPolicy{backoff: time.Second}
+	clk, s, events := newTestSupervisor(policy, countingWard(starts, false))
+
+	done := make(chan interface{})
+	defer close(done)
+	s.start(done, time.Hour)
+	expect(t, starts, "the ward to start")
+
+	for _, backoff := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		// the ward times out
+		clk.BlockUntil(2)
+		clk.Advance(time.Second)
+
+		// then the supervisor waits out the backoff
+		clk.BlockUntil(2)
+		clk.Advance(backoff - time.Millisecond)
+		expectNothing(t, starts, "a ward start before the backoff")
+		clk.Advance(time.Millisecond)
+		expect(t, starts, "the ward to restart")
+		expect(t, events, "an event")
+	}
+}
+
+func TestSupervisorRestartMode(t *testing.T) {
+	t.Run("on failure", func(t *testing.T) {
+		starts := make(chan struct{}, 100)
+		policy := restartPolicy{mode: restartOnFailure}
+		_, s, events := newTestSupervisor(policy, countingWard(starts, true))
+
+		done := make(chan interface{})
+		defer close(done)
+		heartbeat := s.start(done, time.Hour)
+		expect(t, starts, "the ward to start")
+
+		if e := expect(t, events, "an event"); e.kind != eventExit {
+			t.Errorf("got event %v; want %v", e.kind, eventExit)
+		}
+		for range heartbeat {
+		}
+		expectNothing(t, starts, "a ward start")
+	})
+
+	t.Run("always", func(t *testing.T) {
+		starts := make(chan struct{}, 100)
+		policy := restartPolicy{mode: restartAlways, maxRestarts: 3}
+		_, s, events := newTestSupervisor(policy, countingWard(starts, true))
+
+		done := make(chan interface{})
+		defer close(done)
+		heartbeat := s.start(done, time.Hour)
+
+		for i := 0; i < 4; i++ {
+			expect(t, starts, "the ward to start")
+		}
+		for i := 0; i < 3; i++ {
+			if e := expect(t, events, "an event"); e.kind != eventRestart {
+				t.Errorf("got event %v; want %v", e.kind, eventRestart)
+			}
+		}
+		if e := expect(t, events, "an event"); e.kind != eventGaveUp {
+			t.Errorf("got event %v; want %v", e.kind, eventGaveUp)
+		}
+		for range heartbeat {
+		}
+	})
+}
+
+// killableWard returns a ward that logs its starts and stops to events and
+// returns when kill is sent to.
+func killableWard(name string, events chan<- string, kill <-chan struct{}) namedWard {
+	return namedWard{name, func(done <-chan interface{}, _ time.Duration) <-chan interface{} {
+		events <- "start " + name
+		heartbeat := make(chan interface{})
+		go func() {
+			defer close(heartbeat)
+			select {
+			case <-done:
+				events <- "stop " + name
+			case <-kill:
+			}
+		}()
+		return heartbeat
+	}}
+}
+
+// collect returns the next n values sent on ch, starts in the order they were
+// sent and stops sorted, as wards stop concurrently.
+func collect(t *testing.T, ch <-chan string, n int) (starts, stops []string) {
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+		e := expect(t, ch, "a ward to start or stop")
+		if strings.HasPrefix(e, "start") {
+			starts = append(starts, e)
+		} else {
+			stops = append(stops, e)
+		}
+	}
+	sort.Strings(stops)
+	return starts, stops
+}
+
+func TestSupervisorStrategies(t *testing.T) {
+	tests := []struct {
+		strategy   strategy
+		wantStarts []string
+		wantStops  []string
+	}{
+		{
+			strategy:   oneForOne,
+			wantStarts: []string{"start b"},
+		},
+		{
+			strategy:   oneForAll,
+			wantStarts: []string{"start a", "start b", "start c"},
+			wantStops:  []string{"stop a", "stop c"},
+		},
+		{
+			strategy:   restForOne,
+			wantStarts: []string{"start b", "start c"},
+			wantStops:  []string{"stop c"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(fmt.Sprint(tc.strategy), func(t *testing.T) {
+			clk := clock.NewFake(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+			log := make(chan string, 100)
+			kill := make(chan struct{})
+			s := newTreeSupervisor(clk, time.Hour, restartPolicy{}, tc.strategy,
+				killableWard("a", log, nil),
+				killableWard("b", log, kill),
+				killableWard("c", log, nil),
+			)
+			events := make(chan supervisorEvent, 100)
+			s.onEvent = func(e supervisorEvent) { events <- e }
+
+			done := make(chan interface{})
+			heartbeat := s.start(done, time.Hour)
+			if starts, _ := collect(t, log, 3); !reflect.DeepEqual(starts, []string{"start a", "start b", "start c"}) {
+				t.Fatalf("supervisor started %v; want a, b, c in order", starts)
+			}
+
+			kill <- struct{}{}
+			if e := expect(t, events, "an event"); e.kind != eventRestart || e.ward != "b" {
+				t.Errorf("got event %v of %q; want %v of b", e.kind, e.ward, eventRestart)
+			}
+
+			starts, stops := collect(t, log, len(tc.wantStarts)+len(tc.wantStops))
+			if !reflect.DeepEqual(starts, tc.wantStarts) {
+				t.Errorf("supervisor restarted %v; want %v", starts, tc.wantStarts)
+			}
+			if !reflect.DeepEqual(stops, tc.wantStops) {
+				t.Errorf("supervisor stopped %v; want %v", stops, tc.wantStops)
+			}
+
+			close(done)
+			for range heartbeat {
+			}
+			collect(t, log, 3)
+		})
+	}
+}
+
+func TestSupervisorOfSupervisors(t *testing.T) {
+	clk := clock.NewFake(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	log := make(chan string, 100)
+	kill := make(chan struct{})
+
+	// the child gives up on its second restart, the parent then restarts it
+	// and the child starts its ward afresh
+	child := newTreeSupervisor(clk, time.Hour, restartPolicy{maxRestarts: 1}, oneForOne,
+		killableWard("a", log, kill),
+	)
+	childEvents := make(chan supervisorEvent, 100)
+	child.onEvent = func(e supervisorEvent) { childEvents <- e }
+
+	parent := newTreeSupervisor(clk, time.Hour, restartPolicy{}, oneForOne,
+		namedWard{"child", child.start},
+		killableWard("b", log, nil),
+	)
+	parentEvents := make(chan supervisorEvent, 100)
+	parent.onEvent = func(e supervisorEvent) { parentEvents <- e }
+
+	done := make(chan interface{})
+	heartbeat := parent.start(done, time.Hour)
+	collect(t, log, 2)
+
+	kill <- struct{}{}
+	if e := expect(t, childEvents, "a child event"); e.kind != eventRestart {
+		t.Errorf("got child event %v; want %v", e.kind, eventRestart)
+	}
+	if starts, _ := collect(t, log, 1); !reflect.DeepEqual(starts, []string{"start a"}) {
+		t.Errorf("child started %v; want a", starts)
+	}
+
+	kill <- struct{}{}
+	if e := expect(t, childEvents, "a child event"); e.kind != eventGaveUp {
+		t.Errorf("got child event %v; want %v", e.kind, eventGaveUp)
+	}
+	if e := expect(t, parentEvents, "a parent event"); e.kind != eventRestart || e.ward != "child" {
+		t.Errorf("got parent event %v of %q; want %v of child", e.kind, e.ward, eventRestart)
+	}
+	if starts, stops := collect(t, log, 1); !reflect.DeepEqual(starts, []string{"start a"}) {
+		t.Errorf("parent restart started %v and stopped %v; want a started", starts, stops)
+	}
+	expectNothing(t, log, "b to be restarted")
+
+	close(done)
+	for range heartbeat {
+	}
+	collect(t, log, 2)
+}
+
+// failingWard returns a ward that reports reason as soon as it's started.
+func failingWard(starts chan<- struct{}, reason interface{}) startGoroutineFn {
+	return func(done <-chan interface{}, _ time.Duration) <-chan interface{} {
+		starts <- struct{}{}
+		heartbeat := make(chan interface{})
+		go func() {
+			defer close(heartbeat)
+			reportExit(done, heartbeat, reason)
+		}()
+		return heartbeat
+	}
+}
+
+func TestSupervisorFailureReasons(t *testing.T) {
+	errBoom := errors.New("boom")
+	tests := []struct {
+		name   string
+		reason interface{}
+		want   failureKind
+	}{
+		{name: "error", reason: errBoom, want: failureError},
+		{name: "panic value", reason: "boom", want: failurePanic},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			starts := make(chan struct{}, 100)
+			// the clock never moves, so restarts can't be down to timeouts
+			policy := restartPolicy{mode: restartOnFailure, maxRestarts: 2}
+			_, s, events := newTestSupervisor(policy, failingWard(starts, tc.reason))
+
+			done := make(chan interface{})
+			defer close(done)
+			heartbeat := s.start(done, time.Hour)
+
+			for _, kind := range []eventKind{eventRestart, eventRestart, eventGaveUp} {
+				e := expect(t, events, "an event")
+				if e.kind != kind || classify(e.reason) != tc.want {
+					t.Errorf("got event %v for a %v; want %v for a %v",
+						e.kind, classify(e.reason), kind, tc.want)
+				}
+			}
+
+			if got := classify(s.lastFailure("ward")); got != tc.want {
+				t.Errorf("lastFailure() got a %v; want a %v", got, tc.want)
+			}
+			if got := s.lastFailure("nobody"); got != nil {
+				t.Errorf("lastFailure() of an unknown ward got %v; want %v", got, nil)
+			}
+
+			// a supervisor that gives up tells its own steward why
+			reason := expect(t, heartbeat, "the reason the supervisor stopped")
+			if err, _ := reason.(error); classify(err) != failureGaveUp {
+				t.Errorf("supervisor reported %v; want it to have given up", reason)
+			}
+			if err, _ := reason.(error); tc.want == failureError && !errors.Is(err, errBoom) {
+				t.Errorf("supervisor reported %v; want it to wrap %v", err, errBoom)
+			}
+			for range heartbeat {
+			}
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		err  error
+		want failureKind
+	}{
+		{err: nil, want: failureNone},
+		{err: errWardTimeout, want: failureTimeout},
+		{err: panicError{value: 1}, want: failurePanic},
+		{err: errors.New("boom"), want: failureError},
+		{err: gaveUpError{err: errWardTimeout}, want: failureGaveUp},
+		{err: fmt.Errorf("wrapped: %w", errWardTimeout), want: failureTimeout},
+	}
+
+	for _, tc := range tests {
+		if got := classify(tc.err); got != tc.want {
+			t.Errorf("classify(%v) got %v; want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestSupervisorRecoversPanics(t *testing.T) {
+	tests := []struct {
+		name string
+		ward func(starts chan<- struct{}) startGoroutineFn
+		// where the stack trace has to point to
+		wantStack string
+	}{
+		{
+			name: "in the ward's goroutine",
+			ward: func(starts chan<- struct{}) startGoroutineFn {
+				return func(done <-chan interface{}, _ time.Duration) <-chan interface{} {
+					starts <- struct{}{}
+					heartbeat := make(chan interface{})
+					go func() {
+						defer close(heartbeat)
+						defer recoverWard(done, heartbeat)
+						panicky()
+					}()
+					return heartbeat
+				}
+			},
+			wantStack: "panicky",
+		},
+		{
+			name: "in the start function",
+			ward: func(starts chan<- struct{}) startGoroutineFn {
+				return func(done <-chan interface{}, _ time.Duration) <-chan interface{} {
+					starts <- struct{}{}
+					panicky()
+					return nil
+				}
+			},
+			wantStack: "panicky",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			starts := make(chan struct{}, 100)
+			policy := restartPolicy{mode: restartOnFailure, maxRestarts: 1}
+			_, s, events := newTestSupervisor(policy, tc.ward(starts))
+
+			done := make(chan interface{})
+			defer close(done)
+			heartbeat := s.start(done, time.Hour)
+
+			for _, kind := range []eventKind{eventRestart, eventGaveUp} {
+				e := expect(t, events, "an event")
+				if e.kind != kind || classify(e.reason) != failurePanic {
+					t.Fatalf("got event %v for a %v; want %v for a %v",
+						e.kind, classify(e.reason), kind, failurePanic)
+				}
+			}
+			if got := len(starts); got != 2 {
+				t.Errorf("supervisor started the ward %d times; want 2", got)
+			}
+
+			var panicErr panicError
+			if !errors.As(s.lastFailure("ward"), &panicErr) {
+				t.Fatalf("lastFailure() got %v; want a panicError", s.lastFailure("ward"))
+			}
+			if panicErr.value != "oops" {
+				t.Errorf("panicError has value %v; want oops", panicErr.value)
+			}
+			if !strings.Contains(panicErr.StackTrace, tc.wantStack) {
+				t.Errorf("panicError stack trace doesn't mention %s:\n%s", tc.wantStack, panicErr.StackTrace)
+			}
+			for range heartbeat {
+			}
+		})
+	}
+}
+
+func panicky() {
+	panic("oops")
+}
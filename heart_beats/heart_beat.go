@@ -4,10 +4,14 @@ package main
 
 import (
 	"fmt"
+	"github.com/Lumexralph/Concurrency-with-Go/clock"
 	"time"
 )
 
+// doWork sends a result every two pulse intervals, the pulses and results
+// are timed by clk.
 func doWork(
+	clk clock.Clock,
 	done <-chan interface{},
 	pulseInterval time.Duration,
 ) (<-chan interface{}, <-chan time.Time) {
@@ -19,8 +23,11 @@ func doWork(
 
 		// at the every tick if the interval, there will something
 		// to be read from these two channels
-		pulse := time.Tick(pulseInterval)
-		workGen := time.Tick(2 * pulseInterval)
+		pulseTicker := clk.NewTicker(pulseInterval)
+		defer pulseTicker.Stop()
+		workTicker := clk.NewTicker(2 * pulseInterval)
+		defer workTicker.Stop()
+		pulse, workGen := pulseTicker.C(), workTicker.C()
 
 		sendPulse := func() {
 			select {
@@ -59,12 +66,13 @@ func doWork(
 
 // utilizing the heartbeat
 func main() {
+	clk := clock.New()
 	done := make(chan interface{})
 	// cancel the goroutines after 10 secs
 	time.AfterFunc(10*time.Second, func() { close(done) })
 
 	const timeout = 2 * time.Second
-	heartbeat, results := doWork(done, timeout/2)
+	heartbeat, results := doWork(clk, done, timeout/2)
 
 	for {
 		select {
@@ -79,7 +87,7 @@ func main() {
 			}
 			fmt.Printf("results %v\n", r.Second())
 		// when the timeout elapses, end all process
-		case <-time.After(timeout):
+		case <-clk.After(timeout):
 			return
 		}
 	}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"github.com/Lumexralph/Concurrency-with-Go/clock"
+	"testing"
+	"time"
+)
+
+func TestDoWork(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+	done := make(chan interface{})
+	heartbeat, results := doWork(clk, done, time.Second)
+
+	// wait for both the pulse and the work tickers
+	clk.BlockUntil(2)
+	clk.Advance(2 * time.Second)
+
+	if got, want := <-results, start.Add(2*time.Second); !got.Equal(want) {
+		t.Errorf("doWork() got result %v; want %v", got, want)
+	}
+
+	close(done)
+	for range heartbeat {
+	}
+	if _, ok := <-results; ok {
+		t.Error("doWork() results still open after done was closed")
+	}
+}
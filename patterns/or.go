@@ -0,0 +1,96 @@
+package patterns
+
+import (
+	"context"
+	"reflect"
+)
+
+// Or returns a channel that's closed as soon as any of channels is closed,
+// nil if there are none and the channel itself if there's one. However many
+// channels there are, it waits on them from a single goroutine with
+// reflect.Select.
+func Or[T any](channels ...<-chan T) <-chan T {
+	switch len(channels) {
+	case 0:
+		return nil
+	case 1:
+		return channels[0]
+	}
+	return OrContext(context.Background(), channels...)
+}
+
+// OrContext is Or that also closes the channel it returns when ctx is done,
+// which lets the goroutine go when none of channels may ever be closed.
+func OrContext[T any](ctx context.Context, channels ...<-chan T) <-chan T {
+	cases := make([]reflect.SelectCase, 0, len(channels)+1)
+	for _, c := range channels {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c)})
+	}
+	// context.Background() is never done
+	if done := ctx.Done(); done != nil {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)})
+	}
+
+	// nothing can ever close it
+	if len(cases) == 0 {
+		return nil
+	}
+
+	orDone := make(chan T)
+	go func() {
+		defer close(orDone)
+		reflect.Select(cases)
+	}()
+	return orDone
+}
+
+// And returns a channel that's closed once all of channels are closed,
+// straight away if there are none. If done is closed first it gives up and
+// leaves the channel open, so callers waiting on it should wait on done too.
+func And[T any](done <-chan interface{}, channels ...<-chan T) <-chan T {
+	return FirstN(done, len(channels), channels...)
+}
+
+// FirstN returns a channel that's closed once k of channels are closed, a
+// quorum of them. Values sent on channels are received and dropped, only
+// closing a channel counts. It's closed straight away if k < 1 and never if
+// there are fewer than k channels. If done is closed first it gives up and
+// leaves the channel open, so callers waiting on it should wait on done too.
+// Without a done, a quorum that can never be reached doesn't start a
+// goroutine that could never return.
+func FirstN[T any](done <-chan interface{}, k int, channels ...<-chan T) <-chan T {
+	quorum := make(chan T)
+	if k < 1 {
+		close(quorum)
+		return quorum
+	}
+	if done == nil && k > len(channels) {
+		return quorum
+	}
+
+	// done is the first case
+	cases := make([]reflect.SelectCase, 0, len(channels)+1)
+	cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)})
+	for _, c := range channels {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c)})
+	}
+
+	go func() {
+		for k > 0 {
+			i, _, recvOK := reflect.Select(cases)
+			if i == 0 {
+				return
+			}
+			// a value isn't the channel being closed, keep waiting on it
+			if recvOK {
+				continue
+			}
+			// a channel only counts once, a zero Chan is ignored by
+			// reflect.Select from now on
+			cases[i].Chan = reflect.Value{}
+			k--
+		}
+		close(quorum)
+	}()
+	return quorum
+}
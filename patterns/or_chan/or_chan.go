@@ -2,10 +2,13 @@ package main
 
 import (
 	"fmt"
+	"github.com/Lumexralph/Concurrency-with-Go/patterns"
 	"time"
 )
 
-// takes variadic argument of channels and pack it into a slice
+// or is the recursive or-channel, it takes variadic argument of channels and
+// pack it into a slice. It starts a goroutine for about every 2 channels where
+// patterns.Or needs one, it's kept to compare them.
 // var or func(channels ...<-chan interface{}) <-chan interface{}
 func or(channels ...<-chan interface{}) <-chan interface{} {
 	// base index
@@ -48,11 +51,11 @@ func sig(after time.Duration) <-chan interface{} {
 	return c
 }
 
-// wait for any of the channels
+// wait for any of the channels, then for a majority and all of them
 func main() {
 	start := time.Now()
 	// meeting point with main goroutine and other goroutines
-	<-or(
+	<-patterns.Or(
 		sig(2*time.Hour),
 		sig(5*time.Minute),
 		sig(3*time.Second),
@@ -60,4 +63,16 @@ func main() {
 		sig(1*time.Hour),
 	)
 	fmt.Printf("done after %v\n", time.Since(start))
+
+	done := make(chan interface{})
+	defer close(done)
+	replicas := []<-chan interface{}{
+		sig(1 * time.Second),
+		sig(2 * time.Second),
+		sig(3 * time.Second),
+	}
+	<-patterns.FirstN(done, len(replicas)/2+1, replicas...)
+	fmt.Printf("majority of replicas acked after %v\n", time.Since(start))
+	<-patterns.And(done, replicas...)
+	fmt.Printf("all replicas acked after %v\n", time.Since(start))
 }
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"github.com/Lumexralph/Concurrency-with-Go/patterns"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// channels returns n channels that are never closed unless the test does.
+func channels(n int) []chan interface{} {
+	chans := make([]chan interface{}, n)
+	for i := range chans {
+		chans[i] = make(chan interface{})
+	}
+	return chans
+}
+
+func receiveOnly(chans []chan interface{}) []<-chan interface{} {
+	recv := make([]<-chan interface{}, len(chans))
+	for i, c := range chans {
+		recv[i] = c
+	}
+	return recv
+}
+
+// settledGoroutines returns the number of goroutines once it stops going up,
+// the recursive or starts most of its goroutines after it returns.
+func settledGoroutines() int {
+	n := runtime.NumGoroutine()
+	for stable := 0; stable < 3; {
+		time.Sleep(time.Millisecond)
+		if m := runtime.NumGoroutine(); m != n {
+			n, stable = m, 0
+			continue
+		}
+		stable++
+	}
+	return n
+}
+
+// benchmarkOr measures how many goroutines orFn needs for n channels, and how
+// long it takes it to close once the last of them is closed.
+func benchmarkOr(b *testing.B, orFn func(...<-chan interface{}) <-chan interface{}) {
+	for _, n := range []int{10, 100, 1000, 10000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			var goroutines int
+			var latency time.Duration
+			for i := 0; i < b.N; i++ {
+				chans := channels(n)
+				before := settledGoroutines()
+
+				orDone := orFn(receiveOnly(chans)...)
+				goroutines += settledGoroutines() - before
+
+				start := time.Now()
+				close(chans[n-1])
+				<-orDone
+				latency += time.Since(start)
+
+				// let the other goroutines go before the next round
+				for _, c := range chans[:n-1] {
+					close(c)
+				}
+			}
+			b.ReportMetric(float64(goroutines)/float64(b.N), "goroutines/op")
+			b.ReportMetric(float64(latency.Nanoseconds())/float64(b.N), "close-ns/op")
+		})
+	}
+}
+
+func BenchmarkOr(b *testing.B) {
+	benchmarkOr(b, patterns.Or[interface{}])
+}
+
+func BenchmarkOrRecursive(b *testing.B) {
+	benchmarkOr(b, or)
+}
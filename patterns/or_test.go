@@ -0,0 +1,223 @@
+package patterns
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// channels returns n channels that are never closed unless the test does.
+func channels(n int) []chan interface{} {
+	chans := make([]chan interface{}, n)
+	for i := range chans {
+		chans[i] = make(chan interface{})
+	}
+	return chans
+}
+
+func receiveOnly(chans []chan interface{}) []<-chan interface{} {
+	recv := make([]<-chan interface{}, len(chans))
+	for i, c := range chans {
+		recv[i] = c
+	}
+	return recv
+}
+
+// closed reports whether c gets closed soon.
+func closed(c <-chan interface{}) bool {
+	select {
+	case <-c:
+		return true
+	case <-time.After(time.Second):
+		return false
+	}
+}
+
+// open reports whether c stays open for a little while.
+func open(c <-chan interface{}) bool {
+	select {
+	case <-c:
+		return false
+	case <-time.After(20 * time.Millisecond):
+		return true
+	}
+}
+
+func TestOr(t *testing.T) {
+	for _, n := range []int{2, 3, 10, 100} {
+		for _, i := range []int{0, n / 2, n - 1} {
+			t.Run(fmt.Sprintf("%d of %d", i, n), func(t *testing.T) {
+				chans := channels(n)
+				orDone := Or(receiveOnly(chans)...)
+				if !open(orDone) {
+					t.Fatal("Or() closed before any of the channels")
+				}
+
+				close(chans[i])
+				if !closed(orDone) {
+					t.Error("Or() didn't close after one of the channels did")
+				}
+			})
+		}
+	}
+
+	if got := Or[interface{}](); got != nil {
+		t.Errorf("Or() of no channels got %v; want nil", got)
+	}
+	c := make(chan interface{})
+	if got := Or(c); got != c {
+		t.Errorf("Or() of a channel got %v; want the channel", got)
+	}
+}
+
+func TestOrContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	chans := channels(10)
+	orDone := OrContext(ctx, receiveOnly(chans)...)
+	if !open(orDone) {
+		t.Fatal("OrContext() closed before any of the channels or ctx")
+	}
+
+	cancel()
+	if !closed(orDone) {
+		t.Error("OrContext() didn't close after ctx was cancelled")
+	}
+
+	if got := OrContext[interface{}](context.Background()); got != nil {
+		t.Errorf("OrContext() of nothing that's ever done got %v; want nil", got)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	orDone = OrContext[interface{}](ctx)
+	cancel()
+	if !closed(orDone) {
+		t.Error("OrContext() of no channels didn't close after ctx was cancelled")
+	}
+}
+
+func TestFirstN(t *testing.T) {
+	tests := []struct {
+		name string
+		n, k int
+		// how many channels are closed before the quorum is
+		closeFirst int
+	}{
+		{name: "majority", n: 5, k: 3, closeFirst: 2},
+		{name: "one", n: 5, k: 1, closeFirst: 0},
+		{name: "all", n: 5, k: 5, closeFirst: 4},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			done := make(chan interface{})
+			defer close(done)
+
+			chans := channels(tc.n)
+			quorum := FirstN(done, tc.k, receiveOnly(chans)...)
+
+			for _, c := range chans[:tc.closeFirst] {
+				close(c)
+			}
+			if !open(quorum) {
+				t.Fatalf("FirstN() closed after %d of %d channels", tc.closeFirst, tc.k)
+			}
+
+			close(chans[tc.closeFirst])
+			if !closed(quorum) {
+				t.Errorf("FirstN() didn't close after %d channels", tc.k)
+			}
+		})
+	}
+}
+
+func TestFirstNCountsChannelsOnce(t *testing.T) {
+	done := make(chan interface{})
+	defer close(done)
+
+	// a closed channel is always ready, it mustn't make up the quorum alone
+	chans := channels(3)
+	quorum := FirstN(done, 2, receiveOnly(chans)...)
+	close(chans[0])
+	if !open(quorum) {
+		t.Fatal("FirstN() closed with a single channel closed")
+	}
+
+	close(chans[2])
+	if !closed(quorum) {
+		t.Error("FirstN() didn't close after 2 channels")
+	}
+}
+
+func TestFirstNIgnoresValues(t *testing.T) {
+	done := make(chan interface{})
+	defer close(done)
+
+	// only closing a channel counts, one that sends must not make the quorum
+	chans := channels(3)
+	quorum := FirstN(done, 2, receiveOnly(chans)...)
+	chans[0] <- 1
+	chans[1] <- 2
+	close(chans[2])
+	if !open(quorum) {
+		t.Fatal("FirstN() closed after channels sent values")
+	}
+
+	close(chans[0])
+	if !closed(quorum) {
+		t.Error("FirstN() didn't close after 2 channels")
+	}
+}
+
+func TestFirstNUnreachable(t *testing.T) {
+	chans := channels(1)
+	close(chans[0])
+
+	// nothing can ever close it or stop waiting for it
+	if !open(FirstN(nil, 2, receiveOnly(chans)...)) {
+		t.Error("FirstN() of fewer channels than the quorum closed")
+	}
+}
+
+func TestFirstNCancelled(t *testing.T) {
+	done := make(chan interface{})
+	chans := channels(3)
+	quorum := FirstN(done, 2, receiveOnly(chans)...)
+
+	close(done)
+	if !open(quorum) {
+		t.Fatal("FirstN() closed after done was closed; want it left open")
+	}
+
+	// the goroutine is gone, closing channels now changes nothing
+	close(chans[0])
+	close(chans[1])
+	if !open(quorum) {
+		t.Error("FirstN() closed after done was closed; want it left open")
+	}
+}
+
+func TestAnd(t *testing.T) {
+	done := make(chan interface{})
+	defer close(done)
+
+	chans := channels(10)
+	all := And(done, receiveOnly(chans)...)
+	for _, c := range chans[:9] {
+		close(c)
+	}
+	if !open(all) {
+		t.Fatal("And() closed before all of the channels")
+	}
+
+	close(chans[9])
+	if !closed(all) {
+		t.Error("And() didn't close after all of the channels")
+	}
+
+	if !closed(And[interface{}](done)) {
+		t.Error("And() of no channels didn't close")
+	}
+	if !open(FirstN(done, 2, chans[0])) {
+		t.Error("FirstN() of fewer channels than the quorum closed")
+	}
+}
@@ -0,0 +1,231 @@
+// Package patterns is the channel patterns of the examples in its
+// subdirectories as a generic library: or-done, bridge, tee, fan-in, take,
+// repeat and the or-channel with its complements.
+//
+// Every function that starts a goroutine takes a done channel, closing it
+// makes the goroutine stop and close the channels it returns. DoneContext
+// makes one out of a context.Context.
+package patterns
+
+import (
+	"context"
+	"sync"
+)
+
+// DoneContext returns a done channel that's closed once ctx is done.
+func DoneContext(ctx context.Context) <-chan interface{} {
+	done := make(chan interface{})
+	context.AfterFunc(ctx, func() { close(done) })
+	return done
+}
+
+// OrDone returns a channel with the values of c, it's closed when c is or
+// when done is.
+func OrDone[T any](done <-chan interface{}, c <-chan T) <-chan T {
+	valStream := make(chan T)
+	go func() {
+		defer close(valStream)
+		for {
+			select {
+			case <-done:
+				return
+			case v, ok := <-c:
+				// if channel has been closed
+				if !ok {
+					return
+				}
+				// continue reading value from the channel
+				select {
+				case valStream <- v:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+	return valStream
+}
+
+// Bridge destructures a channel of channels into a single channel, it has
+// the values of each channel in turn, in the order the channels come.
+func Bridge[T any](done <-chan interface{}, chanStream <-chan <-chan T) <-chan T {
+	// single channel to return all values
+	// from the stream of channels
+	valStream := make(chan T)
+	go func() {
+		defer close(valStream)
+		// pull values(chan) of the stream of channels
+		for {
+			var stream <-chan T
+			select {
+			case maybeStream, ok := <-chanStream:
+				if !ok {
+					return
+				}
+				stream = maybeStream
+			case <-done:
+				return
+			}
+
+			for val := range OrDone(done, stream) {
+				select {
+				case valStream <- val:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+	return valStream
+}
+
+// Tee returns two channels that both get every value of in, a value has to be
+// read from both before the next one is.
+func Tee[T any](done <-chan interface{}, in <-chan T) (_, _ <-chan T) {
+	out1 := make(chan T)
+	out2 := make(chan T)
+	go func() {
+		defer close(out1)
+		defer close(out2)
+
+		for val := range OrDone(done, in) {
+			// create a local copy of the channels
+			var out1, out2 = out1, out2
+			for i := 0; i < 2; i++ {
+				select {
+				case <-done:
+					return
+				// after writing to the channel,we set it's local
+				// or shadowed copy to nil so that further writes
+				// will block and the other channel can continue
+				case out1 <- val:
+					out1 = nil
+				case out2 <- val:
+					out2 = nil
+				}
+			}
+		}
+	}()
+	return out1, out2
+}
+
+// FanIn joins multiple streams of data into a single stream, it's closed once
+// all of them are.
+func FanIn[T any](done <-chan interface{}, channels ...<-chan T) <-chan T {
+	// want to wait till all channels have been drained
+	var wg sync.WaitGroup
+	multiplexedStream := make(chan T)
+
+	// read from the passed channel and put it into the
+	// multiplexedStream
+	multiplex := func(c <-chan T) {
+		defer wg.Done()
+		for v := range OrDone(done, c) {
+			select {
+			case <-done:
+				return
+			case multiplexedStream <- v:
+			}
+		}
+	}
+
+	wg.Add(len(channels))
+	for _, c := range channels {
+		go multiplex(c)
+	}
+
+	// wait for all the reads to complete
+	go func() {
+		wg.Wait()
+		close(multiplexedStream)
+	}()
+
+	return multiplexedStream
+}
+
+// Take returns a channel with the first num values of valueStream, it's
+// closed early if valueStream is.
+func Take[T any](done <-chan interface{}, valueStream <-chan T, num int) <-chan T {
+	takeStream := make(chan T)
+	go func() {
+		defer close(takeStream)
+		for i := 0; i < num; i++ {
+			var v T
+			select {
+			case <-done:
+				return
+			case val, ok := <-valueStream:
+				if !ok {
+					return
+				}
+				v = val
+			}
+
+			select {
+			case <-done:
+				return
+			case takeStream <- v:
+			}
+		}
+	}()
+	return takeStream
+}
+
+// Repeat returns a channel that gets values over and over until done is
+// closed, it's closed straight away if there are no values.
+func Repeat[T any](done <-chan interface{}, values ...T) <-chan T {
+	valueStream := make(chan T)
+	go func() {
+		defer close(valueStream)
+		if len(values) == 0 {
+			return
+		}
+		for {
+			for _, v := range values {
+				select {
+				case <-done:
+					return
+				case valueStream <- v:
+				}
+			}
+		}
+	}()
+	return valueStream
+}
+
+// RepeatFn returns a channel that gets what fn returns, calling it over and
+// over until done is closed.
+func RepeatFn[T any](done <-chan interface{}, fn func() T) <-chan T {
+	valueStream := make(chan T)
+	go func() {
+		defer close(valueStream)
+		for {
+			select {
+			case <-done:
+				return
+			case valueStream <- fn():
+			}
+		}
+	}()
+	return valueStream
+}
+
+// As returns a channel with the values of valueStream asserted to be of type
+// T, a value of another type panics like a type assertion does. It's toInt
+// for any type.
+func As[T any](done <-chan interface{}, valueStream <-chan interface{}) <-chan T {
+	tStream := make(chan T)
+	go func() {
+		defer close(tStream)
+		for v := range OrDone(done, valueStream) {
+			select {
+			// cancellation/exit the goroutine
+			case <-done:
+				return
+			// assert that the v type is a T and typecast it
+			case tStream <- v.(T):
+			}
+		}
+	}()
+	return tStream
+}
@@ -0,0 +1,226 @@
+package patterns
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// collect returns the values of c until it's closed, it fails t if that
+// takes long.
+func collect[T any](t *testing.T, c <-chan T) []T {
+	t.Helper()
+
+	var got []T
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case v, ok := <-c:
+			if !ok {
+				return got
+			}
+			got = append(got, v)
+		case <-timeout:
+			t.Fatalf("channel still open after a second, got %v so far", got)
+		}
+	}
+}
+
+// stream returns a channel with values, it's closed after the last one.
+func stream[T any](values ...T) <-chan T {
+	c := make(chan T, len(values))
+	for _, v := range values {
+		c <- v
+	}
+	close(c)
+	return c
+}
+
+func TestDoneContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := DoneContext(ctx)
+	if !open(done) {
+		t.Fatal("DoneContext() closed before ctx was cancelled")
+	}
+
+	cancel()
+	if !closed(done) {
+		t.Error("DoneContext() didn't close after ctx was cancelled")
+	}
+}
+
+func TestOrDone(t *testing.T) {
+	done := make(chan interface{})
+	if got, want := collect(t, OrDone(done, stream(1, 2, 3))), []int{1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("OrDone() got %v; want %v", got, want)
+	}
+
+	// c is never closed, done is
+	c := make(chan int)
+	orDone := OrDone(done, c)
+	close(done)
+	if got := collect(t, orDone); len(got) != 0 {
+		t.Errorf("OrDone() after done got %v; want nothing", got)
+	}
+}
+
+func TestBridge(t *testing.T) {
+	done := make(chan interface{})
+	defer close(done)
+
+	chanStream := make(chan (<-chan int), 3)
+	chanStream <- stream(1, 2)
+	chanStream <- stream[int]()
+	chanStream <- stream(3)
+	close(chanStream)
+
+	if got, want := collect(t, Bridge(done, chanStream)), []int{1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Bridge() got %v; want %v", got, want)
+	}
+}
+
+func TestBridgeCancelled(t *testing.T) {
+	done := make(chan interface{})
+	// neither the channel of channels nor its channel is ever closed
+	chanStream := make(chan (<-chan int), 1)
+	chanStream <- Repeat(done, 1)
+
+	bridged := Bridge(done, chanStream)
+	if v := <-bridged; v != 1 {
+		t.Fatalf("Bridge() got %d; want 1", v)
+	}
+	close(done)
+	collect(t, bridged)
+}
+
+func TestTee(t *testing.T) {
+	done := make(chan interface{})
+	defer close(done)
+
+	out1, out2 := Tee(done, stream("a", "b", "c"))
+	var got1, got2 []string
+	for v := range out1 {
+		got1 = append(got1, v)
+		got2 = append(got2, <-out2)
+	}
+
+	want := []string{"a", "b", "c"}
+	if !reflect.DeepEqual(got1, want) || !reflect.DeepEqual(got2, want) {
+		t.Errorf("Tee() got %v and %v; want %v twice", got1, got2, want)
+	}
+	collect(t, out2)
+}
+
+func TestTeeCancelled(t *testing.T) {
+	done := make(chan interface{})
+	out1, out2 := Tee(done, Repeat(done, 1))
+	<-out1
+	close(done)
+	collect(t, out1)
+	collect(t, out2)
+}
+
+func TestFanIn(t *testing.T) {
+	done := make(chan interface{})
+	defer close(done)
+
+	got := collect(t, FanIn(done, stream(1, 4), stream(2), stream[int](), stream(3, 5)))
+	sort.Ints(got)
+	if want := []int{1, 2, 3, 4, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FanIn() got %v; want %v", got, want)
+	}
+
+	if got := collect(t, FanIn[int](done)); len(got) != 0 {
+		t.Errorf("FanIn() of no channels got %v; want nothing", got)
+	}
+}
+
+func TestFanInCancelled(t *testing.T) {
+	done := make(chan interface{})
+	fannedIn := FanIn(done, Repeat(done, 1), Repeat(done, 2))
+	<-fannedIn
+	close(done)
+	collect(t, fannedIn)
+}
+
+func TestTake(t *testing.T) {
+	done := make(chan interface{})
+	defer close(done)
+
+	tests := []struct {
+		name string
+		in   <-chan int
+		num  int
+		want []int
+	}{
+		{name: "some", in: Repeat(done, 1, 2), num: 3, want: []int{1, 2, 1}},
+		{name: "none", in: Repeat(done, 1), num: 0},
+		{name: "more than there are", in: stream(1, 2), num: 5, want: []int{1, 2}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := collect(t, Take(done, tc.in, tc.num)); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Take() got %v; want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTakeCancelled(t *testing.T) {
+	done := make(chan interface{})
+	// nothing ever comes, Take has to give up on receiving too
+	taken := Take(done, make(chan int), 1)
+	close(done)
+	if got := collect(t, taken); len(got) != 0 {
+		t.Errorf("Take() after done got %v; want nothing", got)
+	}
+}
+
+func TestRepeat(t *testing.T) {
+	done := make(chan interface{})
+	defer close(done)
+
+	if got, want := collect(t, Take(done, Repeat(done, "a", "b"), 5)), []string{"a", "b", "a", "b", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Repeat() got %v; want %v", got, want)
+	}
+	if got := collect(t, Repeat[int](done)); len(got) != 0 {
+		t.Errorf("Repeat() of no values got %v; want nothing", got)
+	}
+}
+
+func TestRepeatFn(t *testing.T) {
+	done := make(chan interface{})
+
+	n := 0
+	counter := func() int {
+		n++
+		return n
+	}
+	repeated := RepeatFn(done, counter)
+	if got, want := collect(t, Take(done, repeated, 3)), []int{1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("RepeatFn() got %v; want %v", got, want)
+	}
+
+	close(done)
+	collect(t, repeated)
+}
+
+func TestAs(t *testing.T) {
+	done := make(chan interface{})
+	defer close(done)
+
+	if got, want := collect(t, As[int](done, stream[interface{}](1, 2, 3))), []int{1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("As() got %v; want %v", got, want)
+	}
+}
+
+func TestAsCancelled(t *testing.T) {
+	done := make(chan interface{})
+	asInt := As[int](done, Repeat[interface{}](done, 1))
+	<-asInt
+	close(done)
+	collect(t, asInt)
+}
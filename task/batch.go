@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// A BatchPutterOf function accepts a batch of Ts and stores them in one call,
+// it may return an error. The batch belongs to the function once it's called.
+type BatchPutterOf[T any] func([]T) error
+
+// A BatchPutter function is a BatchPutterOf for Things.
+type BatchPutter = BatchPutterOf[Thing]
+
+// MaybeMoveBatchOf is exactly the same as MaybeMoveOf except that the Ts are
+// put() in batches. A batch is flushed once it holds size Ts or once
+// maxLatency has passed since its first T was fetched, whichever comes first;
+// a maxLatency of 0 means a batch only waits to be full. Whatever is left is
+// flushed once fetch returns false or fails, and an error from put() stops the
+// move just like it does for MaybeMoveOf. The options are the same as for
+// MaybeMoveOf, a put limiter is waited on once per batch.
+func MaybeMoveBatchOf[T any](
+	size int,
+	maxLatency time.Duration,
+	fetch MaybeFetcherOf[T],
+	put BatchPutterOf[T],
+	opts ...MoveOption,
+) error {
+	if size < 1 {
+		size = 1
+	}
+	o := newMoveOptions(opts)
+
+	r := o.recorder()
+	defer r.finish()
+	fetch, put = recordMaybeFetcher(r, fetch), recordBatchPutter(r, put)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fetch = limitMaybeFetcher(ctx, o.fetchLimiter, fetch)
+	if l := o.putLimiter; l != nil {
+		putBatch := put
+		put = func(batch []T) error {
+			if err := l.Wait(ctx); err != nil {
+				return err
+			}
+			return putBatch(batch)
+		}
+	}
+
+	ch := make(chan T)
+	// buffered so the fetch goroutine never blocks on reporting its error
+	fetchErr := make(chan error, 1)
+
+	go func() {
+		defer close(ch)
+
+		for {
+			t, ok, err := fetch()
+			if err != nil {
+				fetchErr <- err
+				return
+			}
+
+			if !ok {
+				return
+			}
+
+			select {
+			// get a signal to stop the goroutine
+			case <-ctx.Done():
+				return
+			case ch <- t:
+			}
+		}
+	}()
+
+	batch := make([]T, 0, size)
+	// the timer only runs while there's something in the batch, a nil
+	// channel blocks forever so the select below ignores it otherwise
+	var timer *time.Timer
+	var timeout <-chan time.Time
+
+	flush := func() error {
+		if timer != nil {
+			timer.Stop()
+			timer, timeout = nil, nil
+		}
+
+		if len(batch) == 0 {
+			return nil
+		}
+
+		b := batch
+		batch = make([]T, 0, size)
+		return put(b)
+	}
+
+	for {
+		select {
+		case thing, ok := <-ch:
+			if !ok {
+				// flush on close, a fetch error still wins over a put error
+				// because it happened first
+				err := flush()
+				select {
+				case fErr := <-fetchErr:
+					return fErr
+				default:
+					return err
+				}
+			}
+
+			batch = append(batch, thing)
+			if len(batch) == 1 && maxLatency > 0 {
+				timer = time.NewTimer(maxLatency)
+				timeout = timer.C
+			}
+
+			if len(batch) < size {
+				continue
+			}
+		case <-timeout:
+		}
+
+		if err := flush(); err != nil {
+			cancel() // signal to end the fetch goroutine
+
+			// wait for the fetch goroutine to return, a fetch() that's
+			// running must not outlive the move
+			for range ch {
+			}
+			return err
+		}
+	}
+}
+
+// MaybeMoveBatch is MaybeMoveBatchOf for Things.
+func MaybeMoveBatch(
+	size int,
+	maxLatency time.Duration,
+	fetch MaybeFetcher,
+	put BatchPutter,
+	opts ...MoveOption,
+) error {
+	return MaybeMoveBatchOf(size, maxLatency, fetch, put, opts...)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"github.com/google/go-cmp/cmp"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// batchStub records every batch it's given, it fails once putErrAt batches
+// have been put when putErrAt is set.
+type batchStub struct {
+	gotBatches [][]Thing
+	putErrAt   int
+}
+
+func (b *batchStub) putBatch(things []Thing) error {
+	if b.putErrAt > 0 && len(b.gotBatches) == b.putErrAt {
+		return errors.New("could not continue putting batch")
+	}
+
+	b.gotBatches = append(b.gotBatches, things)
+	return nil
+}
+
+func TestMaybeMoveBatch(t *testing.T) {
+	checkLeaks(t)
+
+	tests := []struct {
+		name    string
+		size    int
+		stub    *stub
+		want    [][]Thing
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			size: 2,
+			stub: new(stub),
+		},
+		{
+			name: "flush on close",
+			size: 2,
+			stub: &stub{
+				toFetch: []Thing{1, 2, 3, 4, 5},
+			},
+			want: [][]Thing{{1, 2}, {3, 4}, {5}},
+		},
+		{
+			name: "single batch",
+			size: 10,
+			stub: &stub{
+				toFetch: []Thing{1, 2, 3},
+			},
+			want: [][]Thing{{1, 2, 3}},
+		},
+		{
+			name: "errors in fetch",
+			size: 2,
+			stub: &stub{
+				toFetch:  []Thing{1, 2, 3},
+				fetchErr: true,
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := new(batchStub)
+			err := MaybeMoveBatch(tt.size, 0, tt.stub.mayBeFetch, b.putBatch)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("MaybeMoveBatch() got err %v; want error %t", err, tt.wantErr)
+			}
+
+			if diff := cmp.Diff(tt.want, b.gotBatches); diff != "" {
+				t.Errorf("MaybeMoveBatch() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("errors in put", func(t *testing.T) {
+		s := &stub{
+			toFetch: []Thing{1, 2, 3, 4, 5, 6},
+		}
+		b := &batchStub{putErrAt: 1}
+
+		if err := MaybeMoveBatch(2, 0, s.mayBeFetch, b.putBatch); err == nil {
+			t.Errorf("MaybeMoveBatch() should get error, got %v", err)
+		}
+
+		if diff := cmp.Diff([][]Thing{{1, 2}}, b.gotBatches); diff != "" {
+			t.Errorf("MaybeMoveBatch() mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("errors in put with a slow fetch", func(t *testing.T) {
+		s := &stub{
+			toFetch: []Thing{1, 2, 3, 4, 5, 6},
+		}
+		// the fetch after the failing batch is still running when put fails
+		var fetching int32
+		fetch := func() (Thing, bool, error) {
+			atomic.AddInt32(&fetching, 1)
+			defer atomic.AddInt32(&fetching, -1)
+			time.Sleep(20 * time.Millisecond)
+			return s.mayBeFetch()
+		}
+		b := &batchStub{putErrAt: 1}
+
+		if err := MaybeMoveBatch(2, 0, fetch, b.putBatch); err == nil {
+			t.Errorf("MaybeMoveBatch() should get error, got %v", err)
+		}
+
+		if got := atomic.LoadInt32(&fetching); got != 0 {
+			t.Errorf("MaybeMoveBatch() returned with %d fetches running; want 0", got)
+		}
+	})
+
+	t.Run("flush after max latency", func(t *testing.T) {
+		s := &stub{
+			toFetch: []Thing{1, 2, 3},
+		}
+		// every fetch is a lot slower than the latency window so no batch
+		// gets the chance to fill up
+		fetch := func() (Thing, bool, error) {
+			time.Sleep(20 * time.Millisecond)
+			return s.mayBeFetch()
+		}
+		b := new(batchStub)
+
+		if err := MaybeMoveBatch(10, time.Millisecond, fetch, b.putBatch); err != nil {
+			t.Errorf("MaybeMoveBatch() got err %v; want %v", err, nil)
+		}
+
+		if diff := cmp.Diff([][]Thing{{1}, {2}, {3}}, b.gotBatches); diff != "" {
+			t.Errorf("MaybeMoveBatch() mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// A Checkpoint keeps the position a move has reached, that is the number of
+// Things from the start of the source that have been put. It is what lets a
+// move that stopped carry on from where it was instead of from zero.
+type Checkpoint interface {
+	// Load returns the last position that was saved, 0 if there's none.
+	Load() (uint64, error)
+	// Save records pos once it's durable.
+	Save(pos uint64) error
+}
+
+// A FileCheckpoint is a Checkpoint that keeps the position in a file.
+type FileCheckpoint struct {
+	path string
+}
+
+// NewFileCheckpoint returns a Checkpoint backed by the file at path, the file
+// is only created on the first Save.
+func NewFileCheckpoint(path string) *FileCheckpoint {
+	return &FileCheckpoint{path: path}
+}
+
+// Load reads the position from the file, a missing file means nothing has been
+// saved yet.
+func (c *FileCheckpoint) Load() (uint64, error) {
+	b, err := os.ReadFile(c.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+}
+
+// Save writes pos to a temporary file that's synced and then renamed over the
+// checkpoint, so a crash leaves either the old or the new position and never
+// half of one.
+func (c *FileCheckpoint) Save(pos uint64) error {
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return err
+	}
+	// it's gone after the rename, this only cleans up on failure
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(strconv.FormatUint(pos, 10) + "\n"); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return err
+	}
+
+	// the rename itself is only durable once the directory is synced
+	dir, err := os.Open(filepath.Dir(c.path))
+	if err != nil {
+		return err
+	}
+	if err := dir.Sync(); err != nil {
+		dir.Close()
+		return err
+	}
+	return dir.Close()
+}
+
+// A ResumableFetcherOf function returns a MaybeFetcherOf that fetches the Ts of
+// a source starting from the one at pos.
+type ResumableFetcherOf[T any] func(pos uint64) MaybeFetcherOf[T]
+
+// ResumeMoveOf is exactly the same as MaybeMoveLotsOf with a single fetcher
+// except that it starts from the position in cp and saves the position in cp
+// as it goes, after every `every` Ts have been put and once more before it
+// returns. The Ts are put in the order of the source so the saved position
+// always means that every T before it has been put. A value of every less
+// than 1 saves after each T. The options are the same as for MaybeMoveLotsOf,
+// the MoveStats only count the Ts of this run.
+func ResumeMoveOf[T any](
+	ctx context.Context,
+	cp Checkpoint,
+	every int,
+	from ResumableFetcherOf[T],
+	put MaybePutterOf[T],
+	opts ...MoveOption,
+) error {
+	if every < 1 {
+		every = 1
+	}
+
+	pos, err := cp.Load()
+	if err != nil {
+		return err
+	}
+	saved := pos
+
+	// a single fetcher and a single putter keep the Ts in the order of the
+	// source, so counting the puts is enough to know the position
+	moveErr := MaybeMoveLotsOf(ctx, 1, from(pos), func(t T) error {
+		if err := put(t); err != nil {
+			return err
+		}
+
+		pos++
+		if pos-saved < uint64(every) {
+			return nil
+		}
+
+		if err := cp.Save(pos); err != nil {
+			return err
+		}
+		saved = pos
+		return nil
+	}, opts...)
+
+	// whatever happened, don't lose the progress made since the last save
+	if pos != saved {
+		if err := cp.Save(pos); err != nil && moveErr == nil {
+			moveErr = err
+		}
+	}
+	return moveErr
+}
+
+// A ResumableFetcher function is a ResumableFetcherOf for Things.
+type ResumableFetcher = ResumableFetcherOf[Thing]
+
+// ResumeMove is ResumeMoveOf for Things.
+func ResumeMove(
+	ctx context.Context,
+	cp Checkpoint,
+	every int,
+	from ResumableFetcher,
+	put MaybePutter,
+	opts ...MoveOption,
+) error {
+	return ResumeMoveOf(ctx, cp, every, from, put, opts...)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/google/go-cmp/cmp"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileCheckpoint(t *testing.T) {
+	checkLeaks(t)
+
+	cp := NewFileCheckpoint(filepath.Join(t.TempDir(), "move.checkpoint"))
+
+	pos, err := cp.Load()
+	if err != nil || pos != 0 {
+		t.Errorf("Load() of a missing file got %d, %v; want 0, <nil>", pos, err)
+	}
+
+	for _, want := range []uint64{3, 42} {
+		if err := cp.Save(want); err != nil {
+			t.Fatalf("Save(%d) got err %v", want, err)
+		}
+
+		// a new value reads the file again, like a restarted process would
+		pos, err := NewFileCheckpoint(cp.path).Load()
+		if err != nil || pos != want {
+			t.Errorf("Load() got %d, %v; want %d, <nil>", pos, err, want)
+		}
+	}
+}
+
+// resumable returns a ResumableFetcher over the Things of s that fails once
+// failAt Things have been fetched, when failAt isn't 0.
+func (s *stub) resumable(failAt int) ResumableFetcher {
+	return func(pos uint64) MaybeFetcher {
+		s.curr = int(pos)
+		return func() (Thing, bool, error) {
+			if failAt > 0 && s.curr == failAt {
+				return nil, false, errors.New("process crashed")
+			}
+			return s.mayBeFetch()
+		}
+	}
+}
+
+func TestResumeMove(t *testing.T) {
+	checkLeaks(t)
+
+	cp := NewFileCheckpoint(filepath.Join(t.TempDir(), "move.checkpoint"))
+	toFetch := []Thing{1, 2, 3, 4, 5, 6, 7}
+
+	// the first run stops after 4 Things, part way through a save interval
+	first := &stub{toFetch: toFetch}
+	err := ResumeMove(context.Background(), cp, 3, first.resumable(4), first.mayBePut)
+	if err == nil {
+		t.Errorf("ResumeMove() should get error, got %v", err)
+	}
+
+	if pos, _ := cp.Load(); pos != 4 {
+		t.Errorf("ResumeMove() saved position %d; want 4", pos)
+	}
+
+	// the second run only moves what's left
+	second := &stub{toFetch: toFetch}
+	err = ResumeMove(context.Background(), cp, 3, second.resumable(0), second.mayBePut)
+	if err != nil {
+		t.Errorf("ResumeMove() got err %v; want %v", err, nil)
+	}
+
+	if diff := cmp.Diff([]Thing{1, 2, 3, 4}, first.gotPut); diff != "" {
+		t.Errorf("first ResumeMove() mismatch (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]Thing{5, 6, 7}, second.gotPut); diff != "" {
+		t.Errorf("second ResumeMove() mismatch (-want +got):\n%s", diff)
+	}
+
+	if pos, _ := cp.Load(); pos != 7 {
+		t.Errorf("ResumeMove() saved position %d; want 7", pos)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"github.com/Lumexralph/Concurrency-with-Go/clock"
+	"github.com/google/go-cmp/cmp"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestStoresWithFakeClock(t *testing.T) {
+	checkLeaks(t)
+
+	clk := clock.NewFake(epoch)
+	old := &oldStore{bookInventory: []Thing{"Master Go"}, clock: clk}
+	store := &newStore{clock: clk}
+
+	type fetched struct {
+		thing Thing
+		ok    bool
+		err   error
+	}
+	fetch := make(chan fetched)
+	go func() {
+		thing, ok, err := old.fetchCtx(context.Background())
+		fetch <- fetched{thing, ok, err}
+	}()
+
+	// fetchCtx takes 3 seconds, nothing before that
+	clk.BlockUntil(1)
+	clk.Advance(3*time.Second - time.Nanosecond)
+	select {
+	case <-fetch:
+		t.Fatal("fetchCtx() returned before 3 seconds")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	clk.Advance(time.Nanosecond)
+	if got := <-fetch; got.thing != "Master Go" || !got.ok || got.err != nil {
+		t.Errorf("fetchCtx() got %v, %t, %v; want Master Go, true, <nil>", got.thing, got.ok, got.err)
+	}
+
+	put := make(chan error)
+	go func() {
+		put <- store.putCtx(context.Background(), "Master Go")
+	}()
+
+	clk.BlockUntil(1)
+	clk.Advance(5 * time.Second)
+	if err := <-put; err != nil {
+		t.Errorf("putCtx() got err %v; want %v", err, nil)
+	}
+
+	if diff := cmp.Diff([]Thing{"Master Go"}, store.inventory); diff != "" {
+		t.Errorf("putCtx() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestOldStoreFetchesConcurrently(t *testing.T) {
+	checkLeaks(t)
+
+	clk := clock.NewFake(epoch)
+	old := &oldStore{bookInventory: []Thing{"Isomorphic Go", "Master Go"}, clock: clk}
+
+	got := make(chan Thing)
+	for i := 0; i < 2; i++ {
+		go func() {
+			thing, _ := old.fetch()
+			got <- thing
+		}()
+	}
+
+	// both fetches wait 2 seconds then 1 more for their book, the second
+	// wait is only shared if the store isn't locked through it
+	clk.BlockUntil(2)
+	clk.Advance(2 * time.Second)
+	clk.BlockUntil(2)
+	clk.Advance(time.Second)
+
+	books := []Thing{<-got, <-got}
+	if books[0] == books[1] {
+		t.Errorf("fetch() got %v twice; want each book once", books[0])
+	}
+}
+
+func TestDemoMigrationWithFakeClock(t *testing.T) {
+	checkLeaks(t)
+
+	clk := clock.NewFake(epoch)
+	old := &oldStore{
+		bookInventory: []Thing{"concurrency with Go", "Go systems programming",
+			"Isomorphic Go", "Go BluePrints", "Master Go", "Go Library Cookbook"},
+		clock: clk,
+	}
+	store := &newStore{clock: clk}
+
+	start := time.Now()
+	moved := make(chan struct{})
+	go func() {
+		defer close(moved)
+		Move(old.fetch, store.put)
+	}()
+
+	// move time on a second at a time until the move is over, it takes
+	// minutes on the real clock and milliseconds on this one. Time only
+	// moves once the move waits on the clock, which it doesn't any more once
+	// it's over.
+	for over := false; !over; {
+		waiting := make(chan struct{})
+		go func() {
+			defer close(waiting)
+			clk.BlockUntil(1)
+		}()
+
+		select {
+		case <-waiting:
+			clk.Advance(time.Second)
+		case <-moved:
+			over = true
+			// let the go routine waiting on the clock return
+			clk.After(time.Second)
+			<-waiting
+		}
+	}
+
+	if took := time.Since(start); took > 5*time.Second {
+		t.Errorf("Move() took %v of real time", took)
+	}
+
+	if got := stringsOf(store.inventory); len(got) != len(old.bookInventory) {
+		t.Errorf("Move() put %v; want all of %v", got, old.bookInventory)
+	}
+}
+
+// stringsOf returns the Things as strings.
+func stringsOf(things []Thing) []string {
+	s := make([]string, 0, len(things))
+	for _, t := range things {
+		s = append(s, t.(string))
+	}
+	return s
+}
@@ -0,0 +1,30 @@
+package main
+
+import "context"
+
+// A ContextFetcherOf function is exactly the same as a MaybeFetcherOf except
+// that it's given the context of the move, it should give up and return
+// ctx.Err() once ctx is done.
+type ContextFetcherOf[T any] func(ctx context.Context) (_ T, ok bool, _ error)
+
+// A ContextPutterOf function is exactly the same as a MaybePutterOf except
+// that it's given the context of the move, it should give up and return
+// ctx.Err() once ctx is done.
+type ContextPutterOf[T any] func(ctx context.Context, t T) error
+
+// A ContextFetcher function is a ContextFetcherOf for Things.
+type ContextFetcher = ContextFetcherOf[Thing]
+
+// A ContextPutter function is a ContextPutterOf for Things.
+type ContextPutter = ContextPutterOf[Thing]
+
+// MoveContext is MoveContextOf for Things.
+func MoveContext(
+	ctx context.Context,
+	n int,
+	fetch ContextFetcher,
+	put ContextPutter,
+	opts ...MoveOption,
+) error {
+	return MoveContextOf(ctx, n, fetch, put, opts...)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/google/go-cmp/cmp"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMoveContextCancelsInFlight(t *testing.T) {
+	checkLeaks(t)
+
+	old := &oldStore{
+		bookInventory: []Thing{"Isomorphic Go", "Master Go"},
+	}
+	s := new(stub)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	start := time.Now()
+	err := MoveContext(ctx, 1, old.fetchCtx, func(ctx context.Context, t Thing) error {
+		return s.mayBePut(t)
+	})
+	if err != context.Canceled {
+		t.Errorf("MoveContext() got err %v; want %v", err, context.Canceled)
+	}
+
+	// fetchCtx sleeps for seconds when it's not cancelled
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("MoveContext() took %v to return after cancel", took)
+	}
+
+	if len(s.gotPut) != 0 {
+		t.Errorf("MoveContext() got values put %v; want empty", s.gotPut)
+	}
+}
+
+func TestMoveContextCancelsInFlightPut(t *testing.T) {
+	checkLeaks(t)
+
+	s := &stub{
+		toFetch: []Thing{1, 2, 3},
+	}
+	store := new(newStore)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := MoveContext(ctx, 1, func(context.Context) (Thing, bool, error) {
+		return s.mayBeFetch()
+	}, store.putCtx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("MoveContext() got err %v; want %v", err, context.DeadlineExceeded)
+	}
+
+	// putCtx sleeps for seconds when it's not cancelled
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("MoveContext() took %v to return after cancel", took)
+	}
+
+	if len(store.inventory) != 0 {
+		t.Errorf("MoveContext() got values put %v; want empty", store.inventory)
+	}
+}
+
+func TestMoveCtxWaitsForInFlight(t *testing.T) {
+	checkLeaks(t)
+
+	tests := []struct {
+		name        string
+		fetchBlocks bool
+		want        []Thing
+	}{
+		// the T fetched after the cancellation is never put
+		{name: "fetch", fetchBlocks: true},
+		{name: "put", want: []Thing{1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the slow call carries on well past the cancellation
+			var mu sync.Mutex
+			done := false
+			slow := func() {
+				time.Sleep(50 * time.Millisecond)
+				mu.Lock()
+				done = true
+				mu.Unlock()
+			}
+
+			s := &stub{
+				toFetch: []Thing{1, 2, 3},
+			}
+			fetch := func() (Thing, bool) {
+				if tt.fetchBlocks {
+					slow()
+				}
+				return s.fetch()
+			}
+			put := func(t Thing) {
+				if !tt.fetchBlocks {
+					slow()
+				}
+				s.put(t)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+
+			if err := MoveCtx(ctx, fetch, put); err != context.DeadlineExceeded {
+				t.Errorf("MoveCtx() got err %v; want %v", err, context.DeadlineExceeded)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if !done {
+				t.Errorf("MoveCtx() returned before the %s in flight was done", tt.name)
+			}
+
+			if diff := cmp.Diff(tt.want, s.gotPut); diff != "" {
+				t.Errorf("MoveCtx() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMoveContext(t *testing.T) {
+	checkLeaks(t)
+
+	s := &stub{
+		toFetch: []Thing{1, 2, 3},
+	}
+
+	// the stages see the move's context, not the one given to MoveContext
+	parent := context.Background()
+	fetch := func(ctx context.Context) (Thing, bool, error) {
+		if ctx == parent || ctx.Err() != nil {
+			return nil, false, errors.New("fetch got the wrong context")
+		}
+		return s.mayBeFetch()
+	}
+	put := func(ctx context.Context, t Thing) error {
+		if ctx == parent || ctx.Err() != nil {
+			return errors.New("put got the wrong context")
+		}
+		return s.mayBePut(t)
+	}
+
+	if err := MoveContext(parent, 1, fetch, put); err != nil {
+		t.Errorf("MoveContext() got err %v; want %v", err, nil)
+	}
+
+	if diff := cmp.Diff(s.toFetch, s.gotPut); diff != "" {
+		t.Errorf("MoveContext() mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+// A DeadLetterOf value is a T that could not be put along with the error put()
+// returned for it.
+type DeadLetterOf[T any] struct {
+	Thing T
+	Err   error
+}
+
+// A DeadLetter value is a DeadLetterOf for Things.
+type DeadLetter = DeadLetterOf[Thing]
+
+// A MoveSummary counts what became of the Ts of a move.
+type MoveSummary struct {
+	Moved        int // put() without an error
+	Failed       int // put() returned an error
+	DeadLettered int // failed and stored in the dead-letter sink
+}
+
+// MaybeMoveDeadLetterOf is exactly the same as MaybeMoveOf except that an error
+// from put() doesn't stop the move. The T that failed is given to dead along
+// with its error and the move carries on, so the summary says how many Ts were
+// moved, failed and dead-lettered. Only an error from fetch() or from dead is
+// returned, the latter because the T would be lost otherwise. The options are
+// the same as for MaybeMoveOf, except that the MoveStats count a T that was
+// dead-lettered as put, the summary tells the two apart.
+func MaybeMoveDeadLetterOf[T any](
+	fetch MaybeFetcherOf[T],
+	put MaybePutterOf[T],
+	dead MaybePutterOf[DeadLetterOf[T]],
+	opts ...MoveOption,
+) (MoveSummary, error) {
+	var sum MoveSummary
+
+	// MaybeMoveOf calls put from a single go routine, sum needs no locking
+	err := MaybeMoveOf(fetch, func(t T) error {
+		err := put(t)
+		if err == nil {
+			sum.Moved++
+			return nil
+		}
+
+		sum.Failed++
+		if err := dead(DeadLetterOf[T]{Thing: t, Err: err}); err != nil {
+			return err
+		}
+		sum.DeadLettered++
+		return nil
+	}, opts...)
+	return sum, err
+}
+
+// MaybeMoveDeadLetter is MaybeMoveDeadLetterOf for Things.
+func MaybeMoveDeadLetter(
+	fetch MaybeFetcher,
+	put MaybePutter,
+	dead MaybePutterOf[DeadLetter],
+	opts ...MoveOption,
+) (MoveSummary, error) {
+	return MaybeMoveDeadLetterOf(fetch, put, dead, opts...)
+}
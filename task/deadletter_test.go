@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"github.com/google/go-cmp/cmp"
+	"testing"
+)
+
+var errOdd = errors.New("odd things are not accepted")
+
+// putEven only accepts even Things.
+func (s *stub) putEven(t Thing) error {
+	if t.(int)%2 != 0 {
+		return errOdd
+	}
+	return s.mayBePut(t)
+}
+
+func TestMaybeMoveDeadLetter(t *testing.T) {
+	checkLeaks(t)
+
+	s := &stub{
+		toFetch: []Thing{1, 2, 3, 4, 5},
+	}
+
+	var gotDead []DeadLetter
+	dead := func(d DeadLetter) error {
+		gotDead = append(gotDead, d)
+		return nil
+	}
+
+	sum, err := MaybeMoveDeadLetter(s.mayBeFetch, s.putEven, dead)
+	if err != nil {
+		t.Errorf("MaybeMoveDeadLetter() got err %v; want %v", err, nil)
+	}
+
+	if want := (MoveSummary{Moved: 2, Failed: 3, DeadLettered: 3}); sum != want {
+		t.Errorf("MaybeMoveDeadLetter() got summary %+v; want %+v", sum, want)
+	}
+
+	if diff := cmp.Diff([]Thing{2, 4}, s.gotPut); diff != "" {
+		t.Errorf("MaybeMoveDeadLetter() put mismatch (-want +got):\n%s", diff)
+	}
+
+	wantDead := []DeadLetter{{1, errOdd}, {3, errOdd}, {5, errOdd}}
+	if len(gotDead) != len(wantDead) {
+		t.Fatalf("MaybeMoveDeadLetter() got dead letters %v; want %v", gotDead, wantDead)
+	}
+	for i := range wantDead {
+		if gotDead[i] != wantDead[i] {
+			t.Errorf("dead letter %d got %v; want %v", i, gotDead[i], wantDead[i])
+		}
+	}
+}
+
+func TestMaybeMoveDeadLetterErrors(t *testing.T) {
+	checkLeaks(t)
+
+	t.Run("errors in fetch", func(t *testing.T) {
+		s := &stub{
+			toFetch:  []Thing{1, 2},
+			fetchErr: true,
+		}
+		dead := func(DeadLetter) error { return nil }
+
+		sum, err := MaybeMoveDeadLetter(s.mayBeFetch, s.putEven, dead)
+		if err == nil {
+			t.Errorf("MaybeMoveDeadLetter() should get error, got %v", err)
+		}
+
+		if sum != (MoveSummary{}) {
+			t.Errorf("MaybeMoveDeadLetter() got summary %+v; want none", sum)
+		}
+	})
+
+	t.Run("errors in dead letter sink", func(t *testing.T) {
+		s := &stub{
+			toFetch: []Thing{2, 3},
+		}
+		errFull := errors.New("dead letter queue is full")
+		dead := func(DeadLetter) error { return errFull }
+
+		sum, err := MaybeMoveDeadLetter(s.mayBeFetch, s.putEven, dead)
+		if err != errFull {
+			t.Errorf("MaybeMoveDeadLetter() got err %v; want %v", err, errFull)
+		}
+
+		if want := (MoveSummary{Moved: 1, Failed: 1}); sum != want {
+			t.Errorf("MaybeMoveDeadLetter() got summary %+v; want %+v", sum, want)
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// checkLeaks takes a snapshot of the running goroutines and fails t if, once
+// the test and its subtests are over, goroutines that weren't in the snapshot
+// are still running. Goroutines get a second to wind down before they count
+// as leaked.
+func checkLeaks(t *testing.T) {
+	t.Helper()
+
+	before := make(map[string]bool)
+	for _, g := range goroutines() {
+		before[goroutineID(g)] = true
+	}
+
+	t.Cleanup(func() {
+		var leaked []string
+		for deadline := time.Now().Add(time.Second); ; {
+			leaked = leaked[:0]
+			for _, g := range goroutines() {
+				if !before[goroutineID(g)] && !ignoredGoroutine(g) {
+					leaked = append(leaked, g)
+				}
+			}
+
+			if len(leaked) == 0 || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		for _, g := range leaked {
+			t.Errorf("leaked goroutine:\n%s", g)
+		}
+	})
+}
+
+// goroutines returns the stack trace of each running goroutine.
+func goroutines() []string {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	return strings.Split(strings.TrimSpace(string(buf)), "\n\n")
+}
+
+// goroutineID returns the "goroutine N" header of a stack trace from
+// goroutines.
+func goroutineID(g string) string {
+	if i := strings.Index(g, " ["); i >= 0 {
+		return g[:i]
+	}
+	return g
+}
+
+// ignoredGoroutine reports whether g belongs to the testing package or the
+// runtime rather than to the code under test.
+func ignoredGoroutine(g string) bool {
+	for _, s := range []string{
+		"testing.(*T).Run",
+		"testing.tRunner",
+		"testing.runTests",
+		"testing.(*M).",
+		"os/signal.signal_recv",
+		"runtime.goexit0",
+	} {
+		if strings.Contains(g, s) {
+			return true
+		}
+	}
+	return false
+}
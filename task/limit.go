@@ -0,0 +1,64 @@
+package main
+
+import "context"
+
+// A RateLimiter holds a stage of the move back until it's allowed to carry
+// on. It's the Wait half of the RateLimiter in rate_limit, so a *rate.Limiter
+// or one made by Multilimiter can be used as it is.
+type RateLimiter interface {
+	Wait(context.Context) error
+}
+
+// The functions below wait on the limiter with the move's context before
+// every call to fetch or put, they return them untouched when there's no
+// limiter. A failed wait is reported like an error from the stage, it's never
+// taken for the end of the Ts. The context stages wait with the context they
+// are given.
+
+func limitMaybeFetcher[T any](ctx context.Context, l RateLimiter, fetch MaybeFetcherOf[T]) MaybeFetcherOf[T] {
+	if l == nil {
+		return fetch
+	}
+	return func() (t T, ok bool, err error) {
+		if err := l.Wait(ctx); err != nil {
+			return t, false, err
+		}
+		return fetch()
+	}
+}
+
+func limitMaybePutter[T any](ctx context.Context, l RateLimiter, put MaybePutterOf[T]) MaybePutterOf[T] {
+	if l == nil {
+		return put
+	}
+	return func(t T) error {
+		if err := l.Wait(ctx); err != nil {
+			return err
+		}
+		return put(t)
+	}
+}
+
+func limitContextFetcher[T any](l RateLimiter, fetch ContextFetcherOf[T]) ContextFetcherOf[T] {
+	if l == nil {
+		return fetch
+	}
+	return func(ctx context.Context) (t T, ok bool, err error) {
+		if err := l.Wait(ctx); err != nil {
+			return t, false, err
+		}
+		return fetch(ctx)
+	}
+}
+
+func limitContextPutter[T any](l RateLimiter, put ContextPutterOf[T]) ContextPutterOf[T] {
+	if l == nil {
+		return put
+	}
+	return func(ctx context.Context, t T) error {
+		if err := l.Wait(ctx); err != nil {
+			return err
+		}
+		return put(ctx, t)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/google/go-cmp/cmp"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countLimiter lets every wait through and counts them, once blocked it
+// holds every wait until the context is done.
+type countLimiter struct {
+	mu      sync.Mutex
+	waits   int
+	blocked bool
+}
+
+func (l *countLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	l.waits++
+	blocked := l.blocked
+	l.mu.Unlock()
+
+	if !blocked {
+		return nil
+	}
+
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestRateLimitedMove(t *testing.T) {
+	checkLeaks(t)
+
+	s := &stub{
+		toFetch: []Thing{1, 2, 3},
+	}
+	fetchLimiter, putLimiter := new(countLimiter), new(countLimiter)
+
+	err := MaybeMove(s.mayBeFetch, s.mayBePut,
+		WithFetchLimiter(fetchLimiter), WithPutLimiter(putLimiter))
+	if err != nil {
+		t.Errorf("MaybeMove() got err %v; want %v", err, nil)
+	}
+
+	if diff := cmp.Diff(s.toFetch, s.gotPut); diff != "" {
+		t.Errorf("MaybeMove() mismatch (-want +got):\n%s", diff)
+	}
+
+	// the last fetch that finds nothing is throttled too
+	if fetchLimiter.waits != 4 || putLimiter.waits != 3 {
+		t.Errorf("MaybeMove() waited %d times to fetch and %d to put; want 4 and 3",
+			fetchLimiter.waits, putLimiter.waits)
+	}
+}
+
+func TestRateLimitedMoveCancelled(t *testing.T) {
+	checkLeaks(t)
+
+	tests := []struct {
+		name string
+		move func(ctx context.Context, s *stub, opt MoveOption) error
+	}{
+		{
+			name: "MoveCtx",
+			move: func(ctx context.Context, s *stub, opt MoveOption) error {
+				return MoveCtx(ctx, s.fetch, s.put, opt)
+			},
+		},
+		{
+			name: "MaybeMoveLots",
+			move: func(ctx context.Context, s *stub, opt MoveOption) error {
+				return MaybeMoveLots(ctx, 2, s.mayBeFetch, s.mayBePut, opt)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, stage := range []string{"fetch", "put"} {
+			t.Run(tt.name+" "+stage, func(t *testing.T) {
+				s := &stub{
+					toFetch: []Thing{1, 2, 3},
+				}
+				l := &countLimiter{blocked: true}
+				opt := WithFetchLimiter(l)
+				if stage == "put" {
+					opt = WithPutLimiter(l)
+				}
+
+				ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+				defer cancel()
+
+				start := time.Now()
+				if err := tt.move(ctx, s, opt); err != context.DeadlineExceeded {
+					t.Errorf("%s() got err %v; want %v", tt.name, err, context.DeadlineExceeded)
+				}
+
+				if took := time.Since(start); took > time.Second {
+					t.Errorf("%s() took %v to notice the cancellation", tt.name, took)
+				}
+
+				if len(s.gotPut) != 0 {
+					t.Errorf("%s() got values put %v; want empty", tt.name, s.gotPut)
+				}
+			})
+		}
+	}
+}
+
+// errLimiter never lets anything through, like a rate.Limiter with a burst
+// of 0.
+type errLimiter struct{}
+
+func (errLimiter) Wait(context.Context) error {
+	return errors.New("would exceed the burst")
+}
+
+func TestRateLimiterFails(t *testing.T) {
+	checkLeaks(t)
+
+	tests := []struct {
+		name string
+		move func(s *stub, opt MoveOption) error
+	}{
+		{
+			name: "MoveCtx",
+			move: func(s *stub, opt MoveOption) error {
+				return MoveCtx(context.Background(), s.fetch, s.put, opt)
+			},
+		},
+		{
+			name: "MaybeMove",
+			move: func(s *stub, opt MoveOption) error {
+				return MaybeMove(s.mayBeFetch, s.mayBePut, opt)
+			},
+		},
+		{
+			name: "MaybeMoveLots",
+			move: func(s *stub, opt MoveOption) error {
+				return MaybeMoveLots(context.Background(), 2, s.mayBeFetch, s.mayBePut, opt)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, opt := range []MoveOption{WithFetchLimiter(errLimiter{}), WithPutLimiter(errLimiter{})} {
+			s := &stub{
+				toFetch: []Thing{1, 2, 3},
+			}
+
+			if err := tt.move(s, opt); err == nil {
+				t.Errorf("%s() should get error, got %v", tt.name, err)
+			}
+
+			if len(s.gotPut) != 0 {
+				t.Errorf("%s() got values put %v; want empty", tt.name, s.gotPut)
+			}
+		}
+	}
+}
+
+func TestRateLimiterIgnored(t *testing.T) {
+	checkLeaks(t)
+
+	tests := []struct {
+		name string
+		move func(s *stub, opt MoveOption)
+	}{
+		{
+			name: "Move",
+			move: func(s *stub, opt MoveOption) {
+				Move(s.fetch, s.put, opt)
+			},
+		},
+		{
+			name: "MoveBounded",
+			move: func(s *stub, opt MoveOption) {
+				MoveBounded(2, s.fetch, s.put, opt)
+			},
+		},
+		{
+			name: "MoveLots",
+			move: func(s *stub, opt MoveOption) {
+				MoveLots(2, s.fetch, s.put, opt)
+			},
+		},
+	}
+
+	// they can't report a failed wait, so they don't wait at all
+	for _, tt := range tests {
+		for _, opt := range []MoveOption{WithFetchLimiter(errLimiter{}), WithPutLimiter(errLimiter{})} {
+			s := &stub{
+				toFetch: []Thing{1, 2, 3},
+			}
+
+			tt.move(s, opt)
+
+			if diff := cmp.Diff([]int{1, 2, 3}, sortedInts(s.gotPut)); diff != "" {
+				t.Errorf("%s() mismatch (-want +got):\n%s", tt.name, diff)
+			}
+		}
+	}
+}
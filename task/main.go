@@ -0,0 +1,434 @@
+// Package main is the implementation of a family of functions that move
+// Things from a source to a destination concurrently, and of a command that
+// uses them to move records, e.g.
+//
+//	task -in books.csv -out books.jsonl -mode maybelots -n 8 -retries 3
+//
+// reads the rows of books.csv with 8 fetchers and writes them as JSON lines,
+// retrying a failed write up to 3 times. The summary goes to stderr.
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// config holds the command line of the mover.
+type config struct {
+	demo       bool
+	checkpoint string
+
+	in, inFormat string
+	out, dead    string
+
+	mode    string
+	n       int
+	ordered bool
+	timeout time.Duration
+
+	retries int
+	backoff time.Duration
+	onError string
+
+	batch        int
+	batchLatency time.Duration
+}
+
+// the Move variants that -mode can pick
+var modes = []string{
+	"move", "bounded", "ctx", "maybe", "lots", "maybelots", "context", "batch",
+}
+
+func parseFlags(args []string, output io.Writer) (*config, error) {
+	cfg := new(config)
+
+	fs := flag.NewFlagSet("task", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.Usage = func() {
+		fmt.Fprintf(output, "usage: task [flags]\n\n")
+		fmt.Fprintf(output, "Moves records from a JSON lines or CSV source to a JSON lines destination.\n\n")
+		fs.PrintDefaults()
+	}
+
+	fs.BoolVar(&cfg.demo, "demo", false, "move the built-in book inventory and ignore the other flags")
+	fs.StringVar(&cfg.checkpoint, "checkpoint", "", "file to resume the -demo move from and save its position to")
+	fs.StringVar(&cfg.in, "in", "-", "file to read records from, - for stdin")
+	fs.StringVar(&cfg.inFormat, "in-format", "", "jsonl or csv, guessed from the -in extension when empty")
+	fs.StringVar(&cfg.out, "out", "-", "file to write the records to as JSON lines, - for stdout")
+	fs.StringVar(&cfg.dead, "dead", "", "file to write dead letters to with -on-error=deadletter, stderr when empty")
+	fs.StringVar(&cfg.mode, "mode", "maybelots", "Move variant to use: "+strings.Join(modes, ", "))
+	fs.IntVar(&cfg.n, "n", 4, "number of fetchers, or of concurrent puts with -mode=bounded")
+	fs.BoolVar(&cfg.ordered, "ordered", false, "write the records in the order they were read, reading one at a time, with -mode=lots, maybelots and context")
+	fs.DurationVar(&cfg.timeout, "timeout", 0, "give up on the move after this long, 0 never does")
+	fs.IntVar(&cfg.retries, "retries", 0, "number of times a failed read or write is retried")
+	fs.DurationVar(&cfg.backoff, "backoff", 100*time.Millisecond, "delay before the first retry, it doubles after that")
+	fs.StringVar(&cfg.onError, "on-error", "stop", "what a failed write does: stop, skip or deadletter")
+	fs.IntVar(&cfg.batch, "batch", 100, "most records written in one go with -mode=batch")
+	fs.DurationVar(&cfg.batchLatency, "batch-latency", time.Second, "longest a record waits for its batch with -mode=batch")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if !contains(modes, cfg.mode) {
+		return nil, fmt.Errorf("unknown -mode %q", cfg.mode)
+	}
+
+	if !contains([]string{"stop", "skip", "deadletter"}, cfg.onError) {
+		return nil, fmt.Errorf("unknown -on-error %q", cfg.onError)
+	}
+
+	if cfg.inFormat == "" {
+		cfg.inFormat = "jsonl"
+		if strings.EqualFold(filepath.Ext(cfg.in), ".csv") {
+			cfg.inFormat = "csv"
+		}
+	}
+
+	if !contains([]string{"jsonl", "csv"}, cfg.inFormat) {
+		return nil, fmt.Errorf("unknown -in-format %q", cfg.inFormat)
+	}
+	return cfg, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonLinesFetcher returns a MaybeFetcher that decodes one JSON document at a
+// time from r.
+func jsonLinesFetcher(r io.Reader) MaybeFetcher {
+	var mu sync.Mutex
+	dec := json.NewDecoder(r)
+	return func() (Thing, bool, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		var t Thing
+		if err := dec.Decode(&t); err != nil {
+			if err == io.EOF {
+				return nil, false, nil
+			}
+			return nil, false, err
+		}
+		return t, true, nil
+	}
+}
+
+// csvFetcher returns a MaybeFetcher that reads the rows of r after its header,
+// every row is a map from the header to the value of the column.
+func csvFetcher(r io.Reader) MaybeFetcher {
+	var mu sync.Mutex
+	cr := csv.NewReader(r)
+	var header []string
+	return func() (Thing, bool, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if header == nil {
+			h, err := cr.Read()
+			if err == io.EOF {
+				return nil, false, nil
+			}
+			if err != nil {
+				return nil, false, err
+			}
+			header = h
+		}
+
+		row, err := cr.Read()
+		if err == io.EOF {
+			return nil, false, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+
+		record := make(map[string]string, len(header))
+		for i, col := range header {
+			record[col] = row[i]
+		}
+		return record, true, nil
+	}
+}
+
+// jsonLinesPutter returns a MaybePutter that writes every Thing to w as a line
+// of JSON.
+func jsonLinesPutter(w io.Writer) MaybePutter {
+	var mu sync.Mutex
+	return func(t Thing) error {
+		// not a json.Encoder, it gives up for good after a failed write
+		b, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		_, err = w.Write(append(b, '\n'))
+		return err
+	}
+}
+
+// result is what the summary is made of.
+type result struct {
+	stats   MoveStats
+	summary MoveSummary
+	err     error
+}
+
+// run moves the records from in to out as cfg says, dead gets the dead
+// letters.
+func run(ctx context.Context, cfg *config, in io.Reader, out, dead io.Writer) result {
+	if cfg.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.timeout)
+		defer cancel()
+	}
+
+	read := jsonLinesFetcher(in)
+	if cfg.inFormat == "csv" {
+		read = csvFetcher(in)
+	}
+	write := jsonLinesPutter(out)
+
+	// the stages are given the context of the move by the variants that
+	// have one, so a retry backing off gives up as soon as the move does
+	var fetchCtx ContextFetcher = func(context.Context) (Thing, bool, error) {
+		return read()
+	}
+	var putCtx ContextPutter = func(_ context.Context, t Thing) error {
+		return write(t)
+	}
+	if cfg.retries > 0 {
+		p := RetryPolicy{
+			MaxAttempts: cfg.retries + 1,
+			BaseDelay:   cfg.backoff,
+			Jitter:      0.2,
+		}
+		fetchCtx = RetryContextFetcher(p, fetchCtx, nil)
+		putCtx = RetryContextPutter(p, putCtx, nil)
+	}
+
+	// with skip and deadletter a failed write never reaches the mover
+	var res result
+	var sumMu sync.Mutex
+	if cfg.onError != "stop" {
+		var deadPut func(DeadLetter) error
+		if cfg.onError == "deadletter" {
+			deadEnc := jsonLinesPutter(dead)
+			deadPut = func(d DeadLetter) error {
+				return deadEnc(map[string]interface{}{"thing": d.Thing, "error": d.Err.Error()})
+			}
+		}
+
+		maybePut := putCtx
+		putCtx = func(ctx context.Context, t Thing) error {
+			err := maybePut(ctx, t)
+
+			sumMu.Lock()
+			defer sumMu.Unlock()
+
+			if err == nil {
+				res.summary.Moved++
+				return nil
+			}
+
+			res.summary.Failed++
+			if deadPut == nil {
+				return nil
+			}
+
+			if err := deadPut(DeadLetter{Thing: t, Err: err}); err != nil {
+				return err
+			}
+			res.summary.DeadLettered++
+			return nil
+		}
+	}
+
+	// not every variant takes ctx, the stages check it so that -timeout
+	// stops them all
+	maybeFetch, maybePut := fetchCtx, putCtx
+	fetchCtx = func(ctx context.Context) (Thing, bool, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, false, err
+		}
+		return maybeFetch(ctx)
+	}
+	putCtx = func(ctx context.Context, t Thing) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return maybePut(ctx, t)
+	}
+
+	// the variants without a context of their own run the stages with ours
+	fetch := func() (Thing, bool, error) {
+		return fetchCtx(ctx)
+	}
+	put := func(t Thing) error {
+		return putCtx(ctx, t)
+	}
+
+	// the variants without an error stop fetching after the first one and
+	// report it at the end
+	var first firstError
+	fetcher := func() (Thing, bool) {
+		if first.get() != nil {
+			return nil, false
+		}
+
+		t, ok, err := fetch()
+		if err != nil {
+			first.set(err)
+			return nil, false
+		}
+		return t, ok
+	}
+	putter := func(t Thing) {
+		if err := put(t); err != nil {
+			first.set(err)
+		}
+	}
+
+	opts := []MoveOption{WithStats(&res.stats)}
+	if cfg.ordered {
+		opts = append(opts, Ordered())
+	}
+
+	switch cfg.mode {
+	case "move":
+		Move(fetcher, putter, opts...)
+	case "bounded":
+		MoveBounded(cfg.n, fetcher, putter, opts...)
+	case "ctx":
+		res.err = MoveCtx(ctx, fetcher, putter, opts...)
+	case "lots":
+		MoveLots(cfg.n, fetcher, putter, opts...)
+	case "maybe":
+		res.err = MaybeMove(fetch, put, opts...)
+	case "maybelots":
+		res.err = MaybeMoveLots(ctx, cfg.n, fetch, put, opts...)
+	case "context":
+		res.err = MoveContext(ctx, cfg.n, fetchCtx, putCtx, opts...)
+	case "batch":
+		res.err = MaybeMoveBatch(cfg.batch, cfg.batchLatency, fetch,
+			func(things []Thing) error {
+				for _, t := range things {
+					if err := put(t); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			opts...,
+		)
+	}
+
+	if res.err == nil {
+		res.err = first.get()
+	}
+
+	// every stage has returned by now, the lock only makes that plain
+	sumMu.Lock()
+	defer sumMu.Unlock()
+	return res
+}
+
+func printSummary(w io.Writer, cfg *config, res result) {
+	fmt.Fprintf(w, "mode:       %s\n", cfg.mode)
+	// a failed write that was skipped still counts as a put for the mover
+	written := res.stats.Put
+	if cfg.onError != "stop" {
+		written = res.summary.Moved
+	}
+
+	fmt.Fprintf(w, "fetched:    %d\n", res.stats.Fetched)
+	fmt.Fprintf(w, "written:    %d\n", written)
+	if cfg.onError != "stop" {
+		fmt.Fprintf(w, "failed:     %d\n", res.summary.Failed)
+		fmt.Fprintf(w, "dead:       %d\n", res.summary.DeadLettered)
+	}
+	fmt.Fprintf(w, "elapsed:    %v\n", res.stats.Elapsed.Round(time.Millisecond))
+	if res.err != nil {
+		fmt.Fprintf(w, "error:      %v\n", res.err)
+	}
+}
+
+// cli runs the mover with the command line args and returns the exit code.
+func cli(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	cfg, err := parseFlags(args, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	if cfg.demo {
+		demo(cfg.checkpoint)
+		return 0
+	}
+
+	in := stdin
+	if cfg.in != "-" {
+		f, err := os.Open(cfg.in)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+
+	out := stdout
+	if cfg.out != "-" {
+		f, err := os.Create(cfg.out)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		defer f.Close()
+		out = f
+	}
+
+	dead := stderr
+	if cfg.dead != "" {
+		f, err := os.Create(cfg.dead)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		defer f.Close()
+		dead = f
+	}
+
+	res := run(context.Background(), cfg, in, out, dead)
+	printSummary(stderr, cfg, res)
+	if res.err != nil {
+		return 1
+	}
+	return 0
+}
+
+func main() {
+	os.Exit(cli(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
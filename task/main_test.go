@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/google/go-cmp/cmp"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const booksJSONL = `{"title":"Concurrency in Go"}
+{"title":"Isomorphic Go"}
+{"title":"Master Go"}
+`
+
+// sortedLines returns the lines of s in sorted order.
+func sortedLines(s string) []string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	sort.Strings(lines)
+	return lines
+}
+
+func TestCLIModes(t *testing.T) {
+	checkLeaks(t)
+
+	want := sortedLines(booksJSONL)
+
+	for _, mode := range modes {
+		t.Run(mode, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			args := []string{"-mode", mode, "-n", "2"}
+
+			if code := cli(args, strings.NewReader(booksJSONL), &stdout, &stderr); code != 0 {
+				t.Fatalf("cli(%v) exited with %d: %s", args, code, stderr.String())
+			}
+
+			if diff := cmp.Diff(want, sortedLines(stdout.String())); diff != "" {
+				t.Errorf("cli(%v) mismatch (-want +got):\n%s", args, diff)
+			}
+
+			if !strings.Contains(stderr.String(), "written:    3") {
+				t.Errorf("cli(%v) summary %q; want 3 written", args, stderr.String())
+			}
+		})
+	}
+}
+
+// captureStdout runs f with os.Stdout going to a pipe and returns what was
+// written to it, the way a shell reads the output of the command.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- string(b)
+	}()
+
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	f()
+	w.Close()
+	return <-out
+}
+
+func TestCLIStdoutIsJSON(t *testing.T) {
+	checkLeaks(t)
+
+	for _, mode := range modes {
+		t.Run(mode, func(t *testing.T) {
+			var stderr bytes.Buffer
+			args := []string{"-mode", mode, "-n", "2"}
+
+			var code int
+			stdout := captureStdout(t, func() {
+				code = cli(args, strings.NewReader(booksJSONL), os.Stdout, &stderr)
+			})
+			if code != 0 {
+				t.Fatalf("cli(%v) exited with %d: %s", args, code, stderr.String())
+			}
+
+			lines := strings.Split(strings.TrimSpace(stdout), "\n")
+			for _, line := range lines {
+				if !json.Valid([]byte(line)) {
+					t.Errorf("cli(%v) wrote %q to stdout; want JSON lines only", args, line)
+				}
+			}
+
+			if len(lines) != 3 {
+				t.Errorf("cli(%v) wrote %d lines to stdout; want 3", args, len(lines))
+			}
+		})
+	}
+}
+
+func TestCLIFiles(t *testing.T) {
+	checkLeaks(t)
+
+	dir := t.TempDir()
+	in, out := filepath.Join(dir, "books.csv"), filepath.Join(dir, "books.jsonl")
+	csv := "title,year\nConcurrency in Go,2017\nIsomorphic Go,2017\n"
+	if err := os.WriteFile(in, []byte(csv), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"-in", in, "-out", out, "-mode", "lots", "-ordered"}
+	if code := cli(args, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("cli(%v) exited with %d: %s", args, code, stderr.String())
+	}
+
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"title":"Concurrency in Go","year":"2017"}
+{"title":"Isomorphic Go","year":"2017"}
+`
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("cli(%v) mismatch (-want +got):\n%s", args, diff)
+	}
+}
+
+func TestCLIBadFlags(t *testing.T) {
+	checkLeaks(t)
+
+	for _, args := range [][]string{
+		{"-mode", "teleport"},
+		{"-on-error", "panic"},
+		{"-in-format", "xml"},
+	} {
+		var stderr bytes.Buffer
+		if code := cli(args, nil, nil, &stderr); code != 2 {
+			t.Errorf("cli(%v) exited with %d; want 2", args, code)
+		}
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	checkLeaks(t)
+
+	for _, mode := range modes {
+		t.Run(mode, func(t *testing.T) {
+			cfg, err := parseFlags([]string{"-mode", mode, "-n", "2", "-timeout", "1ns"}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var out, dead bytes.Buffer
+			res := run(context.Background(), cfg, strings.NewReader(booksJSONL), &out, &dead)
+
+			if !errors.Is(res.err, context.DeadlineExceeded) {
+				t.Errorf("run() got err %v; want %v", res.err, context.DeadlineExceeded)
+			}
+
+			if out.Len() != 0 {
+				t.Errorf("run() wrote %q; want nothing", out.String())
+			}
+		})
+	}
+}
+
+// slowWriter takes a while over every write and counts the lines written.
+type slowWriter struct {
+	mu    sync.Mutex
+	lines int
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(30 * time.Millisecond)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lines++
+	return len(p), nil
+}
+
+func (w *slowWriter) written() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.lines
+}
+
+func TestRunWaitsForWrites(t *testing.T) {
+	checkLeaks(t)
+
+	// the timeout goes off while a write is running, it must still be done
+	// and counted by the time run returns
+	cfg, err := parseFlags([]string{"-mode", "ctx", "-on-error", "skip", "-timeout", "45ms"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := new(slowWriter)
+	res := run(context.Background(), cfg, strings.NewReader(booksJSONL), out, nil)
+	written := out.written()
+
+	if !errors.Is(res.err, context.DeadlineExceeded) {
+		t.Errorf("run() got err %v; want %v", res.err, context.DeadlineExceeded)
+	}
+
+	if res.summary.Moved != written {
+		t.Errorf("run() got summary %+v; want %d moved", res.summary, written)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if got := out.written(); got != written {
+		t.Errorf("run() wrote %d lines after it returned", got-written)
+	}
+}
+
+// failingWriter fails every write that contains bad.
+type failingWriter struct {
+	bytes.Buffer
+	bad string
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if bytes.Contains(p, []byte(w.bad)) {
+		return 0, errors.New("disk is full")
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestRunErrorPolicy(t *testing.T) {
+	checkLeaks(t)
+
+	tests := []struct {
+		onError     string
+		wantErr     bool
+		wantSummary MoveSummary
+		wantDead    int
+	}{
+		{onError: "stop", wantErr: true},
+		{onError: "skip", wantSummary: MoveSummary{Moved: 2, Failed: 1}},
+		{onError: "deadletter", wantSummary: MoveSummary{Moved: 2, Failed: 1, DeadLettered: 1}, wantDead: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.onError, func(t *testing.T) {
+			cfg, err := parseFlags([]string{"-mode", "maybe", "-on-error", tt.onError}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			out := &failingWriter{bad: "Isomorphic"}
+			var dead bytes.Buffer
+			res := run(context.Background(), cfg, strings.NewReader(booksJSONL), out, &dead)
+
+			if (res.err != nil) != tt.wantErr {
+				t.Errorf("run() got err %v; want error %t", res.err, tt.wantErr)
+			}
+
+			if res.summary != tt.wantSummary {
+				t.Errorf("run() got summary %+v; want %+v", res.summary, tt.wantSummary)
+			}
+
+			if got := strings.Count(dead.String(), "disk is full"); got != tt.wantDead {
+				t.Errorf("run() wrote %d dead letters; want %d", got, tt.wantDead)
+			}
+		})
+	}
+}
@@ -4,68 +4,104 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/Lumexralph/Concurrency-with-Go/clock"
+	"golang.org/x/sync/errgroup"
+	"sync"
 	"time"
 )
 
-// A Thing is a dummy type that we are using for the exercise. It is "fetched"
-// from a source and "put" in a destination.
-type Thing interface{}
-
-// A Fetcher function returns a Thing and a flag similar to the existence flag
-// in a map—it will return true until there are no more Things and then return
+// A FetcherOf function returns a T and a flag similar to the existence flag
+// in a map—it will return true until there are no more Ts and then return
 // false.
-type Fetcher func() (_ Thing, ok bool)
+type FetcherOf[T any] func() (_ T, ok bool)
 
-// A MaybeFetcher function is exactly the same as a Fetcher except that it may
-// return an error.
-type MaybeFetcher func() (_ Thing, ok bool, _ error)
+// A MaybeFetcherOf function is exactly the same as a FetcherOf except that it
+// may return an error.
+type MaybeFetcherOf[T any] func() (_ T, ok bool, _ error)
 
-// A Putter function accepts a Thing and stores it.
-type Putter func(Thing)
+// A PutterOf function accepts a T and stores it.
+type PutterOf[T any] func(T)
 
-// A MaybePutter function is exactly the same as a Putter except that it may
+// A MaybePutterOf function is exactly the same as a PutterOf except that it may
 // return an error.
-type MaybePutter func(Thing) error
+type MaybePutterOf[T any] func(T) error
 
 // fetch function simulates returning Thing until there's nothing else
 // it simulates a process that takes some time
 type oldStore struct {
+	// guards bookNo, the Move*Lots functions fetch concurrently
+	mu            sync.Mutex
 	bookNo        int
 	bookInventory []Thing
+	// the delays are simulated with it, the real clock when it's nil
+	clock clock.Clock
 }
 
 type newStore struct {
+	// guards inventory, Move puts concurrently
+	mu        sync.Mutex
 	inventory []Thing
+	// the delays are simulated with it, the real clock when it's nil
+	clock clock.Clock
+}
+
+// realIfNil returns c, or the real clock if c is nil.
+func realIfNil(c clock.Clock) clock.Clock {
+	if c == nil {
+		return clock.New()
+	}
+	return c
 }
 
 func (o *oldStore) fetch() (thing Thing, ok bool) {
 	// simulate the delay
-	time.Sleep(2 * time.Second)
+	realIfNil(o.clock).Sleep(2 * time.Second)
 
+	// the book is reserved under the lock, the lock isn't held while it's
+	// being read so that other fetches don't queue up behind it
+	o.mu.Lock()
 	if o.bookNo > len(o.bookInventory)-1 {
-
+		o.mu.Unlock()
 		return thing, ok
 	}
 
-	time.Sleep(1 * time.Second)
 	thing, ok = o.bookInventory[o.bookNo], true
 	o.bookNo++
+	o.mu.Unlock()
+
+	realIfNil(o.clock).Sleep(1 * time.Second)
 	return
 }
 
 // put take a value of type Thing and store it in a global map
 // also simulates another long process
 func (n *newStore) put(thing Thing) {
-	time.Sleep(5 * time.Second)
+	realIfNil(n.clock).Sleep(5 * time.Second)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
 
 	n.inventory = append(n.inventory, thing)
 }
 
-// Move concurrently fetches Things from fetch() and puts them in put(). It
-// returns once fetch returns false (i.e. there are no more Things) and all
-// Things have been put().
-func Move(fetch Fetcher, put Putter) {
-	ch := make(chan Thing)
+// MoveOf concurrently fetches Ts from fetch() and puts them in put(). It
+// returns once fetch returns false (i.e. there are no more Ts) and all Ts have
+// been put(). Every T is put() in its own go routine so put must be safe for
+// concurrent use.
+func MoveOf[T any](fetch FetcherOf[T], put PutterOf[T], opts ...MoveOption) {
+	MoveBoundedOf(0, fetch, put, opts...)
+}
+
+// MoveBoundedOf is exactly the same as MoveOf except that no more than limit
+// calls to put() are running at the same time, so a slow put() cannot make it
+// start an unbounded number of go routines. A limit less than 1 means there
+// is no bound.
+func MoveBoundedOf[T any](limit int, fetch FetcherOf[T], put PutterOf[T], opts ...MoveOption) {
+	r := newMoveOptions(opts).recorder()
+	defer r.finish()
+	fetch, put = recordFetcher(r, fetch), recordPutter(r, put)
+
+	ch := make(chan T)
 
 	go func() {
 		defer close(ch)
@@ -79,15 +115,64 @@ func Move(fetch Fetcher, put Putter) {
 		}
 	}()
 
+	// a slot has to be acquired in the semaphore before a put() starts
+	var sem chan struct{}
+	if limit > 0 {
+		sem = make(chan struct{}, limit)
+	}
+
+	// keep track of the put() calls still in flight
+	var wg sync.WaitGroup
+
 	// store the thing
 	for thing := range ch {
-		go put(thing)
+		if sem != nil {
+			sem <- struct{}{}
+		}
+
+		wg.Add(1)
+		go func(thing T) {
+			defer wg.Done()
+			if sem != nil {
+				defer func() { <-sem }()
+			}
+			put(thing)
+		}(thing)
+	}
+
+	wg.Wait()
+}
+
+// firstError keeps the first error reported to it, it's how stages given to
+// the Move variants that can't return an error still get to report one.
+type firstError struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (f *firstError) set(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.err == nil {
+		f.err = err
 	}
 }
 
+func (f *firstError) get() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.err
+}
+
 func (o *oldStore) fetchB() (thing Thing, ok bool, err error) {
 	// simulate the delay
-	time.Sleep(1 * time.Second)
+	realIfNil(o.clock).Sleep(1 * time.Second)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
 	fmt.Println("fetchB: fetching...", o.bookNo)
 
 	if o.bookNo == 5 {
@@ -104,8 +189,63 @@ func (o *oldStore) fetchB() (thing Thing, ok bool, err error) {
 	return
 }
 
+// fetchCtx is exactly the same as fetch except that it gives up as soon as
+// ctx is cancelled instead of sleeping through it.
+func (o *oldStore) fetchCtx(ctx context.Context) (thing Thing, ok bool, err error) {
+	// simulate the delay
+	timer := realIfNil(o.clock).NewTimer(3 * time.Second)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return thing, ok, ctx.Err()
+	case <-timer.C():
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.bookNo > len(o.bookInventory)-1 {
+		return thing, ok, err
+	}
+
+	thing, ok = o.bookInventory[o.bookNo], true
+	o.bookNo++
+	return
+}
+
+// putCtx is exactly the same as put except that it gives up as soon as ctx
+// is cancelled, in which case the thing isn't stored.
+func (n *newStore) putCtx(ctx context.Context, thing Thing) error {
+	timer := realIfNil(n.clock).NewTimer(5 * time.Second)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C():
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.inventory = append(n.inventory, thing)
+	return nil
+}
+
+// resumeFrom returns fetchB starting from the book at pos, it lets the
+// migration carry on from the position kept by a Checkpoint.
+func (o *oldStore) resumeFrom(pos uint64) MaybeFetcher {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.bookNo = int(pos)
+	return o.fetchB
+}
+
 func (n *newStore) putB(thing Thing) error {
-	time.Sleep(2 * time.Second)
+	realIfNil(n.clock).Sleep(2 * time.Second)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
 
 	n.inventory = append(n.inventory, thing)
 
@@ -116,19 +256,29 @@ func (n *newStore) putB(thing Thing) error {
 	return nil
 }
 
-// MaybeMove is exactly the same as Move except that it may return an error
+// MaybeMoveOf is exactly the same as MoveOf except that it may return an error
 // because fetch() and put() may return errors. If no errors occur then
-// MaybeMove returns under the same conditions as Move(). If an error occurs
-// then MaybeMove returns earlier even if there are more Things to fetch().
-func MaybeMove(fetch MaybeFetcher, put MaybePutter) error {
+// MaybeMoveOf returns under the same conditions as MoveOf(). If an error occurs
+// then MaybeMoveOf returns earlier even if there are more Ts to fetch().
+func MaybeMoveOf[T any](fetch MaybeFetcherOf[T], put MaybePutterOf[T], opts ...MoveOption) error {
+	o := newMoveOptions(opts)
+
+	r := o.recorder()
+	defer r.finish()
+	fetch, put = recordMaybeFetcher(r, fetch), recordMaybePutter(r, put)
+
 	// Usually you only use context.Background() in main.main() or tests,
 	// and would accept ctx as the first argument to MaybeMove(ctx) and
 	// then call WithCancel(ctx).
 	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	ch := make(chan Thing)
-	errCh := make(chan error, 2)
+	fetch = limitMaybeFetcher(ctx, o.fetchLimiter, fetch)
+	put = limitMaybePutter(ctx, o.putLimiter, put)
 
+	ch := make(chan T)
+	// only the fetch goroutine sends, and at most once
+	errCh := make(chan error, 1)
 
 	go func() {
 		defer close(ch)
@@ -137,12 +287,10 @@ func MaybeMove(fetch MaybeFetcher, put MaybePutter) error {
 			select {
 			// get a signal to stop the goroutine
 			case <-ctx.Done():
-				fmt.Println("Terminated from Parent Goroutine...")
 				return
 			default:
 				t, ok, err := fetch()
 				if err != nil {
-					fmt.Println("Fetch encountered error")
 					errCh <- err
 					return
 				}
@@ -151,39 +299,88 @@ func MaybeMove(fetch MaybeFetcher, put MaybePutter) error {
 					return
 				}
 
-				ch <- t
+				// nobody receives once put has failed, so don't wait
+				// for them
+				select {
+				case ch <- t:
+				case <-ctx.Done():
+					return
+				}
 			}
 		}
 	}()
 
+	var putErr error
 	for thing := range ch {
 		if err := put(thing); err != nil {
-			fmt.Println("Error in adding to new store", err)
 			cancel() // signal to end the fetch goroutine
-			errCh <- err
+			putErr = err
+			break
 		}
 	}
 
+	// wait for the fetch goroutine to return, it can't be left behind
+	// blocked on a send
+	for range ch {
+	}
 	close(errCh)
 
+	if putErr != nil {
+		return putErr
+	}
 	return <-errCh
 }
 
-// MoveCtx is exactly the same as Move except it honours the
+// MoveCtxOf is exactly the same as MoveOf except it honours the
 // Context-cancellation channel returned by ctx.Done(). If ctx.Done() is closed
-// early then MoveCtx returns ctx.Err() just as MaybeMove returns any errors
-// that it encounters.
-func MoveCtx(ctx context.Context, fetch Fetcher, put Putter) error {
-	ch := make(chan Thing)
+// early then MoveCtxOf returns ctx.Err() just as MaybeMoveOf returns any errors
+// that it encounters. fetch() and put() can't be interrupted, so it stops
+// between them: a fetch() or put() that's running when ctx is cancelled is
+// waited for before it returns. MoveContextOf with a single fetcher passes ctx
+// down to them instead, so they can give up as soon as it's cancelled.
+func MoveCtxOf[T any](ctx context.Context, fetch FetcherOf[T], put PutterOf[T], opts ...MoveOption) error {
+	o := newMoveOptions(opts)
+
+	r := o.recorder()
+	defer r.finish()
+	fetch, put = recordFetcher(r, fetch), recordPutter(r, put)
+
+	// a limiter can fail, the stages are made to return its error so that
+	// it's reported rather than taken for the end of the Ts
+	maybeFetch := limitMaybeFetcher(ctx, o.fetchLimiter, func() (T, bool, error) {
+		t, ok := fetch()
+		return t, ok, nil
+	})
+	maybePut := limitMaybePutter(ctx, o.putLimiter, func(t T) error {
+		put(t)
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ch := make(chan T)
 	var fetchError error
 
 	// I can avoid mixing anonymous function with goroutines
 	go func() {
 		defer close(ch)
 		for {
-			t, ok := fetch()
+			// don't fetch anything else once the context has been cancelled
+			select {
+			case <-ctx.Done():
+				fetchError = ctx.Err()
+				return
+			default:
+			}
+
+			t, ok, err := maybeFetch()
+			if err != nil {
+				fetchError = err
+				return
+			}
+
 			if !ok {
-				fmt.Println("===> I am done!")
 				break
 			}
 
@@ -197,60 +394,181 @@ func MoveCtx(ctx context.Context, fetch Fetcher, put Putter) error {
 	}()
 
 	// store the thing
+	var putError error
 	for thing := range ch {
-		put(thing)
+		// don't start a put() once the context has been cancelled
+		if ctx.Err() != nil {
+			break
+		}
+
+		if err := maybePut(thing); err != nil {
+			putError = err
+			cancel() // signal to end the fetch goroutine
+			break
+		}
+	}
+
+	// wait for the fetch goroutine to return
+	for range ch {
+	}
+
+	if putError != nil {
+		return putError
+	}
+
+	// a put() may have been skipped because ctx was cancelled after the
+	// last fetch
+	if fetchError == nil {
+		fetchError = ctx.Err()
 	}
 	return fetchError
 }
 
-// MoveLots functions like Move and also runs n concurrent go routines to fetch.
-// It only returns once all of the go routines have returned and all the Things
-// have been put().
-func MoveLots(n int, fetch Fetcher, put Putter) {
-	// [TODO]
-
-	for i := 0; i < n; i++ {
-		// [TODO]
-		// Hint: sync.Waitgroup
-		go func() {
-			// [TODO]
+// MoveLotsOf functions like MoveOf and also runs n concurrent go routines to
+// fetch. It only returns once all of the go routines have returned and all the
+// Ts have been put(). fetch is shared by all the go routines so it must be safe
+// for concurrent use, a value of n less than 1 is treated as 1.
+func MoveLotsOf[T any](n int, fetch FetcherOf[T], put PutterOf[T], opts ...MoveOption) {
+	// there's no error and nothing to cancel, so this can't fail
+	_ = MaybeMoveLotsOf(
+		context.Background(),
+		n,
+		func() (T, bool, error) {
 			t, ok := fetch()
-			_, _ = t, ok // [Remove later]
-			// [TODO]
-		}()
-	}
+			return t, ok, nil
+		},
+		func(t T) error {
+			put(t)
+			return nil
+		},
+		append(opts[:len(opts):len(opts)], withoutLimiters)...,
+	)
+}
 
-	var t Thing // [Remove later]
-	// [TODO]
-	put(t)
-	// [TODO]
+// MaybeMoveLotsOf combines the behaviour of all the other Move*Of() functions.
+// It runs n concurrent go routines to fetch like MoveLotsOf, it honours ctx
+// like MoveCtxOf and it may return an error like MaybeMoveOf. The first error from
+// fetch() or put(), or the cancellation of ctx, stops all the go routines and
+// is returned once they have all returned.
+func MaybeMoveLotsOf[T any](
+	ctx context.Context,
+	n int,
+	fetch MaybeFetcherOf[T],
+	put MaybePutterOf[T],
+	opts ...MoveOption,
+) error {
+	// fetch and put can't be interrupted, the move stops between them
+	return MoveContextOf(
+		ctx,
+		n,
+		func(context.Context) (T, bool, error) {
+			return fetch()
+		},
+		func(_ context.Context, t T) error {
+			return put(t)
+		},
+		opts...,
+	)
 }
 
-// MaybeMoveLots combines the behaviour of all the other Move*() functions.
-func MaybeMoveLots(ctx context.Context, n int, fetch MaybeFetcher, put MaybePutter) error {
-	// [TODO]
+// MoveContextOf is exactly the same as MaybeMoveLotsOf except that fetch and
+// put are given the context of the move. It's cancelled along with ctx or as
+// soon as there's an error, so a fetch() or put() that's still running can
+// give up instead of holding the move back until it's done.
+func MoveContextOf[T any](
+	ctx context.Context,
+	n int,
+	fetch ContextFetcherOf[T],
+	put ContextPutterOf[T],
+	opts ...MoveOption,
+) error {
+	if n < 1 {
+		n = 1
+	}
+	o := newMoveOptions(opts)
+
+	r := o.recorder()
+	defer r.finish()
+	fetch, put = recordContextFetcher(r, fetch), recordContextPutter(r, put)
 
+	// the order fetch() got the Ts in is only known when one fetch() runs at
+	// a time, and a single fetcher hands them over in that order
+	if o.ordered {
+		n = 1
+	}
+
+	// the group's context is cancelled as soon as any of its go routines
+	// returns an error, that's the signal for every other one to stop
+	g, ctx := errgroup.WithContext(ctx)
+	fetch = limitContextFetcher(o.fetchLimiter, fetch)
+	put = limitContextPutter(o.putLimiter, put)
+
+	ch := make(chan T)
+
+	var fetchers sync.WaitGroup
+	fetchers.Add(n)
 	for i := 0; i < n; i++ {
-		// [TODO]
-		// Hint: errgroup.WithContext() instead of sync.Waitgroup
-		go func() {
-			// [TODO]
-			t, ok, err := fetch()
-			_, _, _ = t, ok, err // [Remove later]
-			// [TODO]
-		}()
+		g.Go(func() error {
+			defer fetchers.Done()
+			for {
+				// don't fetch anything else once we have been cancelled
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				default:
+				}
+
+				t, ok, err := fetch(ctx)
+				if err != nil {
+					return err
+				}
+
+				if !ok {
+					return nil
+				}
+
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case ch <- t:
+				}
+			}
+		})
 	}
 
-	var t Thing // [Remove later]
-	// [TODO]
-	err := put(t)
-	_ = err // [Remove later]
-	// [TODO]
+	// only this go routine closes the channel, and only once every fetcher
+	// has returned, so nothing can send on it or close it again
+	g.Go(func() error {
+		fetchers.Wait()
+		close(ch)
+		return nil
+	})
 
-	return nil // [Remove later]
+	// store the things until there are no more or we are cancelled
+	g.Go(func() error {
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case t, ok := <-ch:
+				if !ok {
+					return nil
+				}
+
+				if err := put(ctx, t); err != nil {
+					return err
+				}
+			}
+		}
+	})
+
+	return g.Wait()
 }
 
-func main() {
+// demo moves a hard-coded book inventory from an oldStore to a newStore, it's
+// what the -demo flag runs. When checkpoint isn't empty the move carries on
+// from the position saved in that file by the last run, and saves it again.
+func demo(checkpoint string) {
 	old := &oldStore{
 		bookNo: 0,
 		bookInventory: []Thing{"concurrency with Go", "Go systems programming",
@@ -267,6 +585,19 @@ func main() {
 	// err := MoveCtx(ctx, old.fetch, new.put)
 	// fmt.Println(new.inventory, "error: ", err)
 	// fmt.Println("time Elapsed: ", time.Since(t))
+
+	// MoveContext hands ctx down to the stores, so it returns as soon as
+	// it's cancelled rather than when the fetch or put in flight is done.
+	// err := MoveContext(ctx, 1, old.fetchCtx, new.putCtx)
+
+	if checkpoint != "" {
+		cp := NewFileCheckpoint(checkpoint)
+		err := ResumeMove(context.Background(), cp, 1, old.resumeFrom, new.putB)
+		fmt.Println("New Store: ", new.inventory)
+		fmt.Println("ResumeMove: ", err)
+		return
+	}
+
 	err := MaybeMove(old.fetchB, new.putB)
 	fmt.Println("New Store: ", new.inventory)
 	fmt.Println("MaybeMove: ", err)
@@ -6,10 +6,16 @@ import (
 	"fmt"
 	"github.com/google/go-cmp/cmp"
 	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 type stub struct {
+	// guards the fields below when the stub is shared by MoveLots goroutines
+	mu               sync.Mutex
 	toFetch          []Thing
 	curr             int
 	fetchErr, putErr bool
@@ -17,6 +23,9 @@ type stub struct {
 }
 
 func (s *stub) fetch() (Thing, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if s.curr >= len(s.toFetch) {
 		return nil, false
 	}
@@ -27,10 +36,97 @@ func (s *stub) fetch() (Thing, bool) {
 }
 
 func (s *stub) put(t Thing) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	s.gotPut = append(s.gotPut, t)
 }
 
+// slowPut returns a Putter that takes d to store each Thing in s, it records
+// the highest number of calls that were running at the same time in maxActive.
+func (s *stub) slowPut(d time.Duration, maxActive *int32) Putter {
+	var active int32
+	return func(t Thing) {
+		n := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+
+		for {
+			max := atomic.LoadInt32(maxActive)
+			if n <= max || atomic.CompareAndSwapInt32(maxActive, max, n) {
+				break
+			}
+		}
+
+		time.Sleep(d)
+		s.put(t)
+	}
+}
+
+func TestMove(t *testing.T) {
+	checkLeaks(t)
+
+	tests := []struct {
+		name  string
+		limit int
+		stub  *stub
+		want  []int
+	}{
+		{
+			name: "empty",
+			stub: new(stub),
+			want: []int{},
+		},
+		{
+			name: "unbounded",
+			stub: &stub{
+				toFetch: []Thing{1, 2, 3, 4, 5, 6},
+			},
+			want: []int{1, 2, 3, 4, 5, 6},
+		},
+		{
+			name:  "bounded",
+			limit: 2,
+			stub: &stub{
+				toFetch: []Thing{1, 2, 3, 4, 5, 6},
+			},
+			want: []int{1, 2, 3, 4, 5, 6},
+		},
+		{
+			name:  "bounded to one",
+			limit: 1,
+			stub: &stub{
+				toFetch: []Thing{3, 1, 2},
+			},
+			want: []int{1, 2, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var maxActive int32
+			put := tt.stub.slowPut(10*time.Millisecond, &maxActive)
+
+			if tt.limit == 0 {
+				Move(tt.stub.fetch, put)
+			} else {
+				MoveBounded(tt.limit, tt.stub.fetch, put)
+			}
+
+			// every put() must have finished by the time Move returns
+			if diff := cmp.Diff(tt.want, sortedInts(tt.stub.gotPut)); diff != "" {
+				t.Errorf("Move() mismatch (-want +got):\n%s", diff)
+			}
+
+			if tt.limit > 0 && int(maxActive) > tt.limit {
+				t.Errorf("Move() got %d concurrent puts; want at most %d", maxActive, tt.limit)
+			}
+		})
+	}
+}
+
 func TestMoveCtx(t *testing.T) {
+	checkLeaks(t)
+
 	tests := []struct {
 		name string
 		stub *stub
@@ -74,11 +170,15 @@ func TestMoveCtx(t *testing.T) {
 					}
 					defer cancel()
 
-					if err := MoveCtx(ctx, tt.stub.fetch, tt.stub.put); err != wantErr {
+					// each run gets its own stub, otherwise the Things put by the
+					// previous run would still be in gotPut
+					stub := &stub{toFetch: tt.stub.toFetch}
+
+					if err := MoveCtx(ctx, stub.fetch, stub.put); err != wantErr {
 						t.Errorf("MoveCtx() got error %v; want %v", err, wantErr)
 					}
 
-					got := tt.stub.gotPut
+					got := stub.gotPut
 
 					// This is because the playground can only use reflect.DeepEqual, which
 					// doesn't work properly for comparing nil and empty slices.
@@ -89,7 +189,7 @@ func TestMoveCtx(t *testing.T) {
 						return
 					}
 
-					if got, want := tt.stub.gotPut, tt.want; !reflect.DeepEqual(got, want) {
+					if got, want := stub.gotPut, tt.want; !reflect.DeepEqual(got, want) {
 						t.Errorf("MoveCtx() got values put %v; want %v", got, want)
 					}
 				})
@@ -102,6 +202,9 @@ func TestMoveCtx(t *testing.T) {
 
 // MaybeMove tests implementation
 func (s *stub) mayBeFetch() (Thing, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if s.fetchErr == true {
 		return nil, false, errors.New("something went wrong fetching things")
 	}
@@ -116,6 +219,9 @@ func (s *stub) mayBeFetch() (Thing, bool, error) {
 }
 
 func (s *stub) mayBePut(t Thing) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if s.putErr {
 		return errors.New("could not continue putting thing")
 	}
@@ -125,6 +231,8 @@ func (s *stub) mayBePut(t Thing) error {
 }
 
 func TestMaybeMove(t *testing.T) {
+	checkLeaks(t)
+
 	t.Run("no errors during fetch and put", func(t *testing.T) {
 		testCase := struct {
 			stub *stub
@@ -190,3 +298,273 @@ func TestMaybeMove(t *testing.T) {
 		})
 	}
 }
+
+// countingFetch returns a MaybeFetcher that never runs out of Things, the
+// Things are the number of calls so far.
+func countingFetch() MaybeFetcher {
+	var n int64
+	return func() (Thing, bool, error) {
+		return int(atomic.AddInt64(&n, 1)), true, nil
+	}
+}
+
+func TestMaybeMovePutErrorStopsFetching(t *testing.T) {
+	checkLeaks(t)
+
+	tests := []struct {
+		name  string
+		fetch MaybeFetcher
+	}{
+		{
+			name:  "every put fails",
+			fetch: (&stub{toFetch: []Thing{1, 2, 3, 4, 5, 6}}).mayBeFetch,
+		},
+		{
+			name:  "endless fetch",
+			fetch: countingFetch(),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var puts int32
+			put := func(Thing) error {
+				atomic.AddInt32(&puts, 1)
+				return errors.New("could not continue putting thing")
+			}
+
+			errc := make(chan error, 1)
+			go func() { errc <- MaybeMove(tc.fetch, put) }()
+
+			select {
+			case err := <-errc:
+				if err == nil {
+					t.Errorf("MaybeMove() should get error, got %v", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("MaybeMove() did not return after a put error")
+			}
+
+			if got := atomic.LoadInt32(&puts); got != 1 {
+				t.Errorf("MaybeMove() called put %d times; want 1", got)
+			}
+		})
+	}
+}
+
+func TestMoveCtxCancelMidStream(t *testing.T) {
+	checkLeaks(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fetch := countingFetch()
+	var got []Thing
+	put := func(thing Thing) {
+		got = append(got, thing)
+		if len(got) == 3 {
+			cancel()
+		}
+	}
+
+	err := MoveCtx(ctx, func() (Thing, bool) {
+		thing, ok, _ := fetch()
+		return thing, ok
+	}, put)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("MoveCtx() got err %v; want %v", err, context.Canceled)
+	}
+
+	// the fetch that was waiting to hand over a Thing may still win
+	if len(got) < 3 || len(got) > 4 {
+		t.Errorf("MoveCtx() put %v; want 3 or 4 Things", got)
+	}
+}
+
+// sortedInts returns the Things as a sorted slice of ints, MoveLots does not
+// guarantee the order in which Things are put.
+func sortedInts(things []Thing) []int {
+	ints := make([]int, 0, len(things))
+	for _, t := range things {
+		ints = append(ints, t.(int))
+	}
+	sort.Ints(ints)
+	return ints
+}
+
+func TestMoveLots(t *testing.T) {
+	checkLeaks(t)
+
+	tests := []struct {
+		name    string
+		fetcher int
+		stub    *stub
+		want    []int
+	}{
+		{
+			name:    "empty",
+			fetcher: 3,
+			stub:    new(stub),
+			want:    []int{},
+		},
+		{
+			name:    "single fetcher",
+			fetcher: 1,
+			stub: &stub{
+				toFetch: []Thing{1, 2, 3},
+			},
+			want: []int{1, 2, 3},
+		},
+		{
+			name:    "more fetchers than things",
+			fetcher: 10,
+			stub: &stub{
+				toFetch: []Thing{1, 2, 3},
+			},
+			want: []int{1, 2, 3},
+		},
+		{
+			name:    "many things",
+			fetcher: 4,
+			stub: &stub{
+				toFetch: []Thing{5, 3, 8, 1, 9, 2, 7, 4, 6, 10},
+			},
+			want: []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+		},
+		{
+			name:    "no fetchers",
+			fetcher: 0,
+			stub: &stub{
+				toFetch: []Thing{1, 2},
+			},
+			want: []int{1, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			MoveLots(tt.fetcher, tt.stub.fetch, tt.stub.put)
+
+			if diff := cmp.Diff(tt.want, sortedInts(tt.stub.gotPut)); diff != "" {
+				t.Errorf("MoveLots() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMaybeMoveLots(t *testing.T) {
+	checkLeaks(t)
+
+	t.Run("no errors during fetch and put", func(t *testing.T) {
+		s := &stub{
+			toFetch: []Thing{4, 2, 6, 1, 5, 3},
+		}
+
+		err := MaybeMoveLots(context.Background(), 3, s.mayBeFetch, s.mayBePut)
+		if err != nil {
+			t.Errorf("MaybeMoveLots() got err %v; want %v", err, nil)
+		}
+
+		if diff := cmp.Diff([]int{1, 2, 3, 4, 5, 6}, sortedInts(s.gotPut)); diff != "" {
+			t.Errorf("MaybeMoveLots() mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("context cancelled", func(t *testing.T) {
+		s := &stub{
+			toFetch: []Thing{1, 2, 3},
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := MaybeMoveLots(ctx, 3, s.mayBeFetch, s.mayBePut)
+		if err != context.Canceled {
+			t.Errorf("MaybeMoveLots() got err %v; want %v", err, context.Canceled)
+		}
+
+		if len(s.gotPut) != 0 {
+			t.Errorf("MaybeMoveLots() got values put %v; want empty", s.gotPut)
+		}
+	})
+
+	testCases := []struct {
+		name string
+		stub *stub
+	}{
+		{
+			name: "errors in put",
+			stub: &stub{
+				toFetch: []Thing{1, 2, 3, 4, 5},
+				putErr:  true,
+			},
+		},
+		{
+			name: "errors in fetch",
+			stub: &stub{
+				toFetch:  []Thing{1, 2},
+				fetchErr: true,
+			},
+		},
+		{
+			name: "errors in fetch and put",
+			stub: &stub{
+				toFetch:  []Thing{1, 2},
+				fetchErr: true,
+				putErr:   true,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := MaybeMoveLots(context.Background(), 3, tc.stub.mayBeFetch, tc.stub.mayBePut)
+			if err == nil || err == context.Canceled {
+				t.Errorf("MaybeMoveLots() should get the fetch or put error, got %v", err)
+			}
+
+			if len(tc.stub.gotPut) != 0 {
+				t.Errorf("MaybeMoveLots() got values put %v; want empty", tc.stub.gotPut)
+			}
+		})
+	}
+}
+
+func TestMaybeMoveLotsOf(t *testing.T) {
+	checkLeaks(t)
+
+	books := []string{"Isomorphic Go", "Master Go", "Go BluePrints"}
+
+	var mu sync.Mutex
+	var curr int
+	fetch := func() (string, bool, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if curr >= len(books) {
+			return "", false, nil
+		}
+		curr++
+		return books[curr-1], true, nil
+	}
+
+	// put takes a string, there's no type assertion from a Thing
+	var got []string
+	put := func(book string) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		got = append(got, book)
+		return nil
+	}
+
+	if err := MaybeMoveLotsOf(context.Background(), 2, fetch, put); err != nil {
+		t.Errorf("MaybeMoveLotsOf() got err %v; want %v", err, nil)
+	}
+
+	sort.Strings(got)
+	want := []string{"Go BluePrints", "Isomorphic Go", "Master Go"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("MaybeMoveLotsOf() mismatch (-want +got):\n%s", diff)
+	}
+}
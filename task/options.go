@@ -0,0 +1,90 @@
+package main
+
+import "time"
+
+// A MoveOption changes how the Move*Of functions move Ts.
+type MoveOption func(*moveOptions)
+
+type moveOptions struct {
+	ordered bool
+
+	interval time.Duration
+	progress func(MoveStats)
+	stats    *MoveStats
+
+	fetchLimiter, putLimiter RateLimiter
+}
+
+func newMoveOptions(opts []MoveOption) *moveOptions {
+	o := new(moveOptions)
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// recorder returns what keeps the stats of the move, nil when neither
+// WithProgress nor WithStats was given.
+func (o *moveOptions) recorder() *statsRecorder {
+	if o.progress == nil && o.stats == nil {
+		return nil
+	}
+	return newStatsRecorder(o.interval, o.progress, o.stats)
+}
+
+// Ordered makes the mover put Ts in the order fetch() got them. That order
+// is only known when one fetch() runs at a time, so an ordered move runs a
+// single fetcher whatever n it's given and only overlaps that fetcher with
+// put(). Only MoveLotsOf, MaybeMoveLotsOf and MoveContextOf use it, the
+// others already put in order or don't promise any.
+func Ordered() MoveOption {
+	return func(o *moveOptions) {
+		o.ordered = true
+	}
+}
+
+// WithProgress calls progress with the MoveStats of the move at every
+// interval while it runs, and one last time once it's over. Calls to
+// progress are never concurrent, a slow progress delays the next report but
+// not the move.
+func WithProgress(interval time.Duration, progress func(MoveStats)) MoveOption {
+	return func(o *moveOptions) {
+		o.interval = interval
+		o.progress = progress
+	}
+}
+
+// WithStats stores the final MoveStats of the move in stats before the Move*Of
+// function returns. That's how the final MoveStats are handed out, rather
+// than as a result of the Move*Of functions, so that adding stats didn't
+// change their signatures. Every function of the Move family accepts it.
+func WithStats(stats *MoveStats) MoveOption {
+	return func(o *moveOptions) {
+		o.stats = stats
+	}
+}
+
+// WithFetchLimiter makes every call to fetch() wait for l first. The wait
+// uses the context of the move so cancelling it interrupts a throttled
+// fetcher. A wait that fails is returned like an error from fetch(), so only
+// the Move*Of functions that return an error use it. MoveOf, MoveBoundedOf and
+// MoveLotsOf ignore it, they would have no way to report the failure.
+func WithFetchLimiter(l RateLimiter) MoveOption {
+	return func(o *moveOptions) {
+		o.fetchLimiter = l
+	}
+}
+
+// WithPutLimiter makes every call to put() wait for l first, just like
+// WithFetchLimiter does for fetch().
+func WithPutLimiter(l RateLimiter) MoveOption {
+	return func(o *moveOptions) {
+		o.putLimiter = l
+	}
+}
+
+// withoutLimiters drops the limiters given to a Move*Of function that can't
+// return an error before it hands its options on to one that can.
+func withoutLimiters(o *moveOptions) {
+	o.fetchLimiter, o.putLimiter = nil, nil
+}
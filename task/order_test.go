@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"github.com/google/go-cmp/cmp"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ledger hands out the numbers 0 to size-1 after a random latency, and
+// records the order they're put in. The latency comes before a number is
+// reserved, or after it when reserveFirst is set.
+type ledger struct {
+	mu           sync.Mutex
+	size         int
+	reserveFirst bool
+	curr         int
+	fetching     int // calls to fetch() running right now
+	maxFetching  int
+	gotPut       []int
+}
+
+func (l *ledger) fetch() (int, bool, error) {
+	l.mu.Lock()
+	l.fetching++
+	if l.fetching > l.maxFetching {
+		l.maxFetching = l.fetching
+	}
+	l.mu.Unlock()
+
+	defer func() {
+		l.mu.Lock()
+		l.fetching--
+		l.mu.Unlock()
+	}()
+
+	latency := time.Duration(rand.Intn(3000)) * time.Microsecond
+	if !l.reserveFirst {
+		time.Sleep(latency)
+	}
+
+	l.mu.Lock()
+	if l.curr >= l.size {
+		l.mu.Unlock()
+		return 0, false, nil
+	}
+
+	l.curr++
+	i := l.curr - 1
+	l.mu.Unlock()
+
+	if l.reserveFirst {
+		time.Sleep(latency)
+	}
+	return i, true, nil
+}
+
+func (l *ledger) put(i int) error {
+	time.Sleep(time.Duration(rand.Intn(1000)) * time.Microsecond)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.gotPut = append(l.gotPut, i)
+	return nil
+}
+
+func TestMaybeMoveLotsOrdered(t *testing.T) {
+	checkLeaks(t)
+
+	const size = 50
+
+	want := make([]int, size)
+	for i := range want {
+		want[i] = i
+	}
+
+	for _, reserveFirst := range []bool{false, true} {
+		l := &ledger{size: size, reserveFirst: reserveFirst}
+		err := MaybeMoveLotsOf(context.Background(), 4, l.fetch, l.put, Ordered())
+		if err != nil {
+			t.Errorf("MaybeMoveLotsOf() reserveFirst %t got err %v; want %v", reserveFirst, err, nil)
+		}
+
+		if diff := cmp.Diff(want, l.gotPut); diff != "" {
+			t.Errorf("MaybeMoveLotsOf() reserveFirst %t order mismatch (-want +got):\n%s", reserveFirst, diff)
+		}
+
+		if l.maxFetching > 1 {
+			t.Errorf("MaybeMoveLotsOf() ran %d fetches at once; want at most 1", l.maxFetching)
+		}
+	}
+}
+
+func TestMoveLotsOrdered(t *testing.T) {
+	checkLeaks(t)
+
+	s := &stub{
+		toFetch: []Thing{1, 2, 3, 4, 5, 6, 7, 8},
+	}
+
+	MoveLots(3, s.fetch, s.put, Ordered())
+
+	if diff := cmp.Diff(s.toFetch, s.gotPut); diff != "" {
+		t.Errorf("MoveLots() order mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMaybeMoveLotsOrderedSlowFirstFetch(t *testing.T) {
+	checkLeaks(t)
+
+	// the first record is reserved first but its fetch returns last
+	var mu sync.Mutex
+	next := 0
+	fetch := func() (int, bool, error) {
+		mu.Lock()
+		i := next
+		next++
+		mu.Unlock()
+
+		if i >= 4 {
+			return 0, false, nil
+		}
+		if i == 0 {
+			time.Sleep(50 * time.Millisecond)
+		}
+		return i, true, nil
+	}
+
+	var got []int
+	put := func(i int) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, i)
+		return nil
+	}
+
+	if err := MaybeMoveLotsOf(context.Background(), 2, fetch, put, Ordered()); err != nil {
+		t.Fatalf("MaybeMoveLotsOf() got err %v; want %v", err, nil)
+	}
+
+	if diff := cmp.Diff([]int{0, 1, 2, 3}, got); diff != "" {
+		t.Errorf("MaybeMoveLotsOf() order mismatch (-want +got):\n%s", diff)
+	}
+}
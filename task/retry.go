@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// A RetryPolicy describes how a MaybeFetcherOf or MaybePutterOf that failed
+// gets called again. The delay before each retry doubles, starting from
+// BaseDelay, until it reaches MaxDelay.
+type RetryPolicy struct {
+	MaxAttempts int           // attempts in total, less than 1 means 1
+	BaseDelay   time.Duration // delay before the first retry
+	MaxDelay    time.Duration // the delay never grows past this, 0 means no bound
+	// Jitter is the fraction of each delay, between 0 and 1, that is random
+	// so that the callers failing together don't all retry together.
+	Jitter float64
+	// Retryable classifies the errors that are worth another attempt, every
+	// error is retried when it's nil.
+	Retryable func(error) bool
+}
+
+// An AttemptsFuncOf function is told how many attempts it took to fetch or put
+// a T and the error of the last attempt, if any. A fetch that failed reports
+// the zero T.
+type AttemptsFuncOf[T any] func(item T, attempts int, err error)
+
+// backoff returns how long to wait before the retry-th retry.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	d := p.BaseDelay
+	// stop doubling before d overflows, a long run of retries would wrap it
+	// around to 0 or less otherwise
+	for i := 1; i < retry && d > 0 && d < math.MaxInt64/2; i++ {
+		if p.MaxDelay > 0 && d >= p.MaxDelay {
+			break
+		}
+		d *= 2
+	}
+
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+
+	if p.Jitter > 0 {
+		d -= time.Duration(p.Jitter * rand.Float64() * float64(d))
+	}
+	return d
+}
+
+// do calls op until it succeeds, it fails with an error that's not
+// retryable or the attempts run out. It waits on ctx between attempts and
+// returns ctx.Err() if ctx is done first.
+func (p RetryPolicy) do(ctx context.Context, op func() error) (attempts int, err error) {
+	for {
+		attempts++
+		if err = op(); err == nil {
+			return attempts, nil
+		}
+
+		if attempts >= p.MaxAttempts || (p.Retryable != nil && !p.Retryable(err)) {
+			return attempts, err
+		}
+
+		timer := time.NewTimer(p.backoff(attempts))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempts, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// RetryFetcherOf wraps fetch so that every failed call is retried according
+// to p. report, if it's not nil, is called after every fetch with the number
+// of attempts it took. The waits between attempts give up once ctx is done,
+// it's only the context of the move when the move is run with ctx: a move
+// that's cancelled or failed on its own doesn't interrupt them,
+// RetryContextFetcherOf does.
+func RetryFetcherOf[T any](
+	ctx context.Context,
+	p RetryPolicy,
+	fetch MaybeFetcherOf[T],
+	report AttemptsFuncOf[T],
+) MaybeFetcherOf[T] {
+	retry := RetryContextFetcherOf(p, func(context.Context) (T, bool, error) {
+		return fetch()
+	}, report)
+	return func() (T, bool, error) {
+		return retry(ctx)
+	}
+}
+
+// RetryPutterOf wraps put so that every failed call is retried according to
+// p. report, if it's not nil, is called after every put with the number of
+// attempts it took. Like RetryFetcherOf, only ctx interrupts the waits
+// between attempts, RetryContextPutterOf waits on the context of the move.
+func RetryPutterOf[T any](
+	ctx context.Context,
+	p RetryPolicy,
+	put MaybePutterOf[T],
+	report AttemptsFuncOf[T],
+) MaybePutterOf[T] {
+	retry := RetryContextPutterOf(p, func(_ context.Context, t T) error {
+		return put(t)
+	}, report)
+	return func(t T) error {
+		return retry(ctx, t)
+	}
+}
+
+// RetryContextFetcherOf is exactly the same as RetryFetcherOf except that it
+// waits between attempts on the context every call is given, the move's, and
+// hands it down to fetch. A move that's cancelled, or stopped by an error
+// elsewhere, doesn't wait for a fetch that's backing off.
+func RetryContextFetcherOf[T any](
+	p RetryPolicy,
+	fetch ContextFetcherOf[T],
+	report AttemptsFuncOf[T],
+) ContextFetcherOf[T] {
+	return func(ctx context.Context) (t T, ok bool, err error) {
+		attempts, err := p.do(ctx, func() (err error) {
+			t, ok, err = fetch(ctx)
+			return err
+		})
+		if err != nil {
+			var zero T
+			t, ok = zero, false
+		}
+
+		if report != nil {
+			report(t, attempts, err)
+		}
+		return t, ok, err
+	}
+}
+
+// RetryContextPutterOf is exactly the same as RetryPutterOf except that it
+// waits between attempts on the context every call is given, just like
+// RetryContextFetcherOf.
+func RetryContextPutterOf[T any](
+	p RetryPolicy,
+	put ContextPutterOf[T],
+	report AttemptsFuncOf[T],
+) ContextPutterOf[T] {
+	return func(ctx context.Context, t T) error {
+		attempts, err := p.do(ctx, func() error {
+			return put(ctx, t)
+		})
+
+		if report != nil {
+			report(t, attempts, err)
+		}
+		return err
+	}
+}
+
+// RetryFetcher is RetryFetcherOf for Things.
+func RetryFetcher(
+	ctx context.Context,
+	p RetryPolicy,
+	fetch MaybeFetcher,
+	report AttemptsFuncOf[Thing],
+) MaybeFetcher {
+	return RetryFetcherOf(ctx, p, fetch, report)
+}
+
+// RetryPutter is RetryPutterOf for Things.
+func RetryPutter(
+	ctx context.Context,
+	p RetryPolicy,
+	put MaybePutter,
+	report AttemptsFuncOf[Thing],
+) MaybePutter {
+	return RetryPutterOf(ctx, p, put, report)
+}
+
+// RetryContextFetcher is RetryContextFetcherOf for Things.
+func RetryContextFetcher(
+	p RetryPolicy,
+	fetch ContextFetcher,
+	report AttemptsFuncOf[Thing],
+) ContextFetcher {
+	return RetryContextFetcherOf(p, fetch, report)
+}
+
+// RetryContextPutter is RetryContextPutterOf for Things.
+func RetryContextPutter(
+	p RetryPolicy,
+	put ContextPutter,
+	report AttemptsFuncOf[Thing],
+) ContextPutter {
+	return RetryContextPutterOf(p, put, report)
+}
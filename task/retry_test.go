@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/google/go-cmp/cmp"
+	"testing"
+	"time"
+)
+
+var errFlaky = errors.New("network issues")
+
+// flakyStub fails the first failures calls to every Thing it fetches or puts.
+type flakyStub struct {
+	stub
+	failures  int
+	fetchFail int
+	putFail   map[Thing]int
+}
+
+func (f *flakyStub) mayBeFetch() (Thing, bool, error) {
+	if f.fetchFail < f.failures {
+		f.fetchFail++
+		return nil, false, errFlaky
+	}
+	f.fetchFail = 0
+	return f.stub.mayBeFetch()
+}
+
+func (f *flakyStub) mayBePut(t Thing) error {
+	if f.putFail == nil {
+		f.putFail = make(map[Thing]int)
+	}
+
+	if f.putFail[t] < f.failures {
+		f.putFail[t]++
+		return errFlaky
+	}
+	return f.stub.mayBePut(t)
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	checkLeaks(t)
+
+	p := RetryPolicy{
+		BaseDelay: 10 * time.Millisecond,
+		MaxDelay:  50 * time.Millisecond,
+	}
+
+	want := []time.Duration{
+		10 * time.Millisecond,
+		20 * time.Millisecond,
+		40 * time.Millisecond,
+		50 * time.Millisecond,
+		50 * time.Millisecond,
+	}
+	for i, w := range want {
+		if got := p.backoff(i + 1); got != w {
+			t.Errorf("backoff(%d) got %v; want %v", i+1, got, w)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 1; i < 100; i++ {
+		if got := p.backoff(i); got < 5*time.Millisecond || got > 50*time.Millisecond {
+			t.Errorf("backoff(%d) with jitter got %v; want between 5ms and 50ms", i, got)
+		}
+	}
+}
+
+func TestRetryPolicyBackoffNoOverflow(t *testing.T) {
+	checkLeaks(t)
+
+	p := RetryPolicy{BaseDelay: time.Millisecond}
+	prev := p.backoff(1)
+	for i := 2; i <= 200; i++ {
+		got := p.backoff(i)
+		if got < prev {
+			t.Fatalf("backoff(%d) got %v; want at least backoff(%d) = %v", i, got, i-1, prev)
+		}
+		prev = got
+	}
+}
+
+func TestRetryMaybeMove(t *testing.T) {
+	checkLeaks(t)
+
+	tests := []struct {
+		name      string
+		failures  int
+		policy    RetryPolicy
+		want      []Thing
+		wantErr   error
+		wantFetch []int
+	}{
+		{
+			name:      "recovers before attempts run out",
+			failures:  2,
+			policy:    RetryPolicy{MaxAttempts: 3},
+			want:      []Thing{1, 2},
+			wantFetch: []int{3, 3, 3},
+		},
+		{
+			name:      "attempts run out",
+			failures:  3,
+			policy:    RetryPolicy{MaxAttempts: 3},
+			wantErr:   errFlaky,
+			wantFetch: []int{3},
+		},
+		{
+			name:     "error is not retryable",
+			failures: 1,
+			policy: RetryPolicy{
+				MaxAttempts: 3,
+				Retryable: func(err error) bool {
+					return err != errFlaky
+				},
+			},
+			wantErr:   errFlaky,
+			wantFetch: []int{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &flakyStub{
+				stub:     stub{toFetch: []Thing{1, 2}},
+				failures: tt.failures,
+			}
+
+			var gotFetch []int
+			reportFetch := func(_ Thing, attempts int, _ error) {
+				gotFetch = append(gotFetch, attempts)
+			}
+			// put has its own failures, every Thing needs the same attempts
+			reportPut := func(_ Thing, attempts int, err error) {
+				if err == nil && attempts != tt.failures+1 {
+					t.Errorf("put took %d attempts; want %d", attempts, tt.failures+1)
+				}
+			}
+
+			ctx := context.Background()
+			err := MaybeMove(
+				RetryFetcher(ctx, tt.policy, f.mayBeFetch, reportFetch),
+				RetryPutter(ctx, tt.policy, f.mayBePut, reportPut),
+			)
+			if err != tt.wantErr {
+				t.Errorf("MaybeMove() got err %v; want %v", err, tt.wantErr)
+			}
+
+			if diff := cmp.Diff(tt.want, f.gotPut); diff != "" {
+				t.Errorf("MaybeMove() mismatch (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tt.wantFetch, gotFetch); diff != "" {
+				t.Errorf("fetch attempts mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRetryCancelledBetweenAttempts(t *testing.T) {
+	checkLeaks(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	p := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Hour}
+	put := RetryPutter(ctx, p, func(Thing) error { return errFlaky }, nil)
+
+	start := time.Now()
+	if err := put(1); err != context.Canceled {
+		t.Errorf("put() got err %v; want %v", err, context.Canceled)
+	}
+
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("put() took %v to notice the cancellation", took)
+	}
+}
+
+func TestRetryContextStopsWithTheMove(t *testing.T) {
+	checkLeaks(t)
+
+	// the put of 1 backs off for an hour, the next fetch fails for good and
+	// the move must not wait for the put to wake up
+	errBroken := errors.New("source is gone")
+	fetched := 0
+	fetch := func(context.Context) (Thing, bool, error) {
+		fetched++
+		if fetched > 1 {
+			return nil, false, errBroken
+		}
+		return fetched, true, nil
+	}
+
+	p := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Hour}
+	put := RetryContextPutter(p, func(context.Context, Thing) error { return errFlaky }, nil)
+
+	errc := make(chan error, 1)
+	go func() { errc <- MoveContext(context.Background(), 1, fetch, put) }()
+
+	select {
+	case err := <-errc:
+		if err != errBroken {
+			t.Errorf("MoveContext() got err %v; want %v", err, errBroken)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("MoveContext() waited for the put backing off")
+	}
+}
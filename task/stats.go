@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MoveStats is a snapshot of how a move is getting on.
+type MoveStats struct {
+	Fetched  int // Ts that fetch() returned
+	Put      int // Ts that put() stored without an error
+	Failed   int // calls to fetch() or put() that returned an error
+	InFlight int // Ts that have been fetched but not put yet
+	// Dropped is the Ts that were fetched but will never be put, either
+	// their put() failed or the move stopped before it put them. The latter
+	// only count once the move is over, they're in flight until then.
+	Dropped int
+
+	Elapsed    time.Duration // since the move started
+	Throughput float64       // Ts put per second since the move started
+
+	FetchLatency time.Duration // average time a call to fetch() took
+	PutLatency   time.Duration // average time a call to put() took
+}
+
+// A statsRecorder keeps the numbers behind MoveStats while a move runs and
+// reports them at the interval and to the destination set by the options.
+type statsRecorder struct {
+	mu                     sync.Mutex
+	start                  time.Time
+	fetches, puts          int
+	fetchTime, putTime     time.Duration
+	fetched, put           int
+	fetchFailed, putFailed int
+	failedTs               int // Ts in the calls to put() that failed
+	over                   bool
+
+	interval time.Duration
+	progress func(MoveStats)
+	dst      *MoveStats
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newStatsRecorder(interval time.Duration, progress func(MoveStats), dst *MoveStats) *statsRecorder {
+	r := &statsRecorder{
+		start:    time.Now(),
+		interval: interval,
+		progress: progress,
+		dst:      dst,
+		done:     make(chan struct{}),
+	}
+
+	if progress != nil && interval > 0 {
+		r.wg.Add(1)
+		go r.report()
+	}
+	return r
+}
+
+// report calls progress with a snapshot at every interval until finish.
+func (r *statsRecorder) report() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			r.progress(r.stats())
+		}
+	}
+}
+
+// finish stops the periodic reports and hands out the final stats, progress
+// gets them last so it always sees how the move ended.
+func (r *statsRecorder) finish() {
+	if r == nil {
+		return
+	}
+
+	close(r.done)
+	r.wg.Wait()
+
+	// nothing is in flight once the move is over, what wasn't put by then
+	// never will be
+	r.mu.Lock()
+	r.over = true
+	r.mu.Unlock()
+
+	s := r.stats()
+	if r.dst != nil {
+		*r.dst = s
+	}
+	if r.progress != nil {
+		r.progress(s)
+	}
+}
+
+func (r *statsRecorder) stats() MoveStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := MoveStats{
+		Fetched:  r.fetched,
+		Put:      r.put,
+		Failed:   r.fetchFailed + r.putFailed,
+		InFlight: r.fetched - r.put - r.failedTs,
+		Dropped:  r.failedTs,
+		Elapsed:  time.Since(r.start),
+	}
+	if r.over {
+		s.Dropped += s.InFlight
+		s.InFlight = 0
+	}
+
+	if s.Elapsed > 0 {
+		s.Throughput = float64(r.put) / s.Elapsed.Seconds()
+	}
+	if r.fetches > 0 {
+		s.FetchLatency = r.fetchTime / time.Duration(r.fetches)
+	}
+	if r.puts > 0 {
+		s.PutLatency = r.putTime / time.Duration(r.puts)
+	}
+	return s
+}
+
+func (r *statsRecorder) fetchDone(start time.Time, ok bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.fetches++
+	r.fetchTime += time.Since(start)
+	switch {
+	case err != nil:
+		r.fetchFailed++
+	case ok:
+		r.fetched++
+	}
+}
+
+// putDone records a call to put() with n Ts, that's more than one for a
+// batch.
+func (r *statsRecorder) putDone(start time.Time, n int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.puts++
+	r.putTime += time.Since(start)
+	if err != nil {
+		r.putFailed++
+		r.failedTs += n
+		return
+	}
+	r.put += n
+}
+
+// The functions below wrap fetch and put so that every call is recorded, they
+// return them untouched when no stats were asked for.
+
+func recordFetcher[T any](r *statsRecorder, fetch FetcherOf[T]) FetcherOf[T] {
+	if r == nil {
+		return fetch
+	}
+	return func() (T, bool) {
+		start := time.Now()
+		t, ok := fetch()
+		r.fetchDone(start, ok, nil)
+		return t, ok
+	}
+}
+
+func recordMaybeFetcher[T any](r *statsRecorder, fetch MaybeFetcherOf[T]) MaybeFetcherOf[T] {
+	if r == nil {
+		return fetch
+	}
+	return func() (T, bool, error) {
+		start := time.Now()
+		t, ok, err := fetch()
+		r.fetchDone(start, ok, err)
+		return t, ok, err
+	}
+}
+
+func recordPutter[T any](r *statsRecorder, put PutterOf[T]) PutterOf[T] {
+	if r == nil {
+		return put
+	}
+	return func(t T) {
+		start := time.Now()
+		put(t)
+		r.putDone(start, 1, nil)
+	}
+}
+
+func recordMaybePutter[T any](r *statsRecorder, put MaybePutterOf[T]) MaybePutterOf[T] {
+	if r == nil {
+		return put
+	}
+	return func(t T) error {
+		start := time.Now()
+		err := put(t)
+		r.putDone(start, 1, err)
+		return err
+	}
+}
+
+func recordContextFetcher[T any](r *statsRecorder, fetch ContextFetcherOf[T]) ContextFetcherOf[T] {
+	if r == nil {
+		return fetch
+	}
+	return func(ctx context.Context) (T, bool, error) {
+		start := time.Now()
+		t, ok, err := fetch(ctx)
+		r.fetchDone(start, ok, err)
+		return t, ok, err
+	}
+}
+
+func recordContextPutter[T any](r *statsRecorder, put ContextPutterOf[T]) ContextPutterOf[T] {
+	if r == nil {
+		return put
+	}
+	return func(ctx context.Context, t T) error {
+		start := time.Now()
+		err := put(ctx, t)
+		r.putDone(start, 1, err)
+		return err
+	}
+}
+
+func recordBatchPutter[T any](r *statsRecorder, put BatchPutterOf[T]) BatchPutterOf[T] {
+	if r == nil {
+		return put
+	}
+	return func(batch []T) error {
+		start := time.Now()
+		n := len(batch) // put owns the batch once it's called
+		err := put(batch)
+		r.putDone(start, n, err)
+		return err
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMoveStats(t *testing.T) {
+	checkLeaks(t)
+
+	t.Run("MoveCtx", func(t *testing.T) {
+		s := &stub{
+			toFetch: []Thing{1, 2, 3},
+		}
+
+		var stats MoveStats
+		if err := MoveCtx(context.Background(), s.fetch, s.put, WithStats(&stats)); err != nil {
+			t.Errorf("MoveCtx() got err %v; want %v", err, nil)
+		}
+
+		if stats.Fetched != 3 || stats.Put != 3 || stats.Failed != 0 || stats.InFlight != 0 {
+			t.Errorf("MoveCtx() got stats %+v; want 3 fetched and put", stats)
+		}
+
+		if stats.Elapsed <= 0 || stats.Throughput <= 0 {
+			t.Errorf("MoveCtx() got stats %+v; want elapsed time and throughput", stats)
+		}
+	})
+
+	t.Run("MaybeMove errors in put", func(t *testing.T) {
+		s := &stub{
+			toFetch: []Thing{1},
+			putErr:  true,
+		}
+
+		var stats MoveStats
+		if err := MaybeMove(s.mayBeFetch, s.mayBePut, WithStats(&stats)); err == nil {
+			t.Errorf("MaybeMove() should get error, got %v", err)
+		}
+
+		if stats.Fetched != 1 || stats.Put != 0 || stats.Failed != 1 || stats.InFlight != 0 {
+			t.Errorf("MaybeMove() got stats %+v; want 1 fetched and failed", stats)
+		}
+	})
+
+	t.Run("MaybeMove drops what's fetched after a put error", func(t *testing.T) {
+		s := &stub{
+			toFetch: []Thing{1, 2, 3},
+			putErr:  true,
+		}
+
+		var stats MoveStats
+		if err := MaybeMove(s.mayBeFetch, s.mayBePut, WithStats(&stats)); err == nil {
+			t.Errorf("MaybeMove() should get error, got %v", err)
+		}
+
+		// the fetcher may have got more Things before it saw the error
+		if stats.Fetched < 1 || stats.Dropped != stats.Fetched || stats.InFlight != 0 {
+			t.Errorf("MaybeMove() got stats %+v; want every fetched Thing dropped", stats)
+		}
+	})
+
+	t.Run("MaybeMoveBatch", func(t *testing.T) {
+		s := &stub{
+			toFetch: []Thing{1, 2, 3, 4, 5},
+		}
+		b := &batchStub{putErrAt: 1}
+
+		var stats MoveStats
+		if err := MaybeMoveBatch(2, 0, s.mayBeFetch, b.putBatch, WithStats(&stats)); err == nil {
+			t.Errorf("MaybeMoveBatch() should get error, got %v", err)
+		}
+
+		if stats.Put != 2 || stats.Failed != 1 || stats.InFlight != 0 || stats.Dropped != stats.Fetched-2 {
+			t.Errorf("MaybeMoveBatch() got stats %+v; want 2 put and the rest dropped", stats)
+		}
+	})
+
+	t.Run("MaybeMoveDeadLetter", func(t *testing.T) {
+		s := &stub{
+			toFetch: []Thing{1, 2, 3, 4},
+		}
+		dead := func(DeadLetter) error { return nil }
+
+		var stats MoveStats
+		if _, err := MaybeMoveDeadLetter(s.mayBeFetch, s.putEven, dead, WithStats(&stats)); err != nil {
+			t.Errorf("MaybeMoveDeadLetter() got err %v; want %v", err, nil)
+		}
+
+		if stats.Fetched != 4 || stats.Put != 4 || stats.InFlight != 0 {
+			t.Errorf("MaybeMoveDeadLetter() got stats %+v; want 4 fetched and put", stats)
+		}
+	})
+
+	t.Run("ResumeMove", func(t *testing.T) {
+		cp := NewFileCheckpoint(filepath.Join(t.TempDir(), "move.checkpoint"))
+		if err := cp.Save(1); err != nil {
+			t.Fatalf("Save() got err %v", err)
+		}
+		s := &stub{
+			toFetch: []Thing{1, 2, 3},
+		}
+
+		var stats MoveStats
+		if err := ResumeMove(context.Background(), cp, 1, s.resumable(0), s.mayBePut, WithStats(&stats)); err != nil {
+			t.Errorf("ResumeMove() got err %v; want %v", err, nil)
+		}
+
+		if stats.Fetched != 2 || stats.Put != 2 || stats.InFlight != 0 {
+			t.Errorf("ResumeMove() got stats %+v; want the 2 Things after the checkpoint", stats)
+		}
+	})
+
+	t.Run("MoveLots latency", func(t *testing.T) {
+		s := &stub{
+			toFetch: []Thing{1, 2, 3, 4},
+		}
+		var maxActive int32
+
+		var stats MoveStats
+		MoveLots(2, s.fetch, s.slowPut(5*time.Millisecond, &maxActive), WithStats(&stats))
+
+		if stats.Put != 4 {
+			t.Errorf("MoveLots() got %d put; want 4", stats.Put)
+		}
+
+		if stats.PutLatency < 5*time.Millisecond {
+			t.Errorf("MoveLots() got put latency %v; want at least 5ms", stats.PutLatency)
+		}
+	})
+}
+
+func TestWithProgress(t *testing.T) {
+	checkLeaks(t)
+
+	s := &stub{
+		toFetch: []Thing{1, 2, 3, 4, 5},
+	}
+	var maxActive int32
+
+	// progress is never called concurrently, no need to lock
+	var reports []MoveStats
+	progress := func(stats MoveStats) {
+		reports = append(reports, stats)
+	}
+
+	var final MoveStats
+	MoveBounded(1, s.fetch, s.slowPut(10*time.Millisecond, &maxActive),
+		WithProgress(5*time.Millisecond, progress), WithStats(&final))
+
+	if len(reports) < 2 {
+		t.Fatalf("WithProgress() got %d reports; want some while moving and a final one", len(reports))
+	}
+
+	if last := reports[len(reports)-1]; last != final {
+		t.Errorf("WithProgress() got last report %+v; want the final stats %+v", last, final)
+	}
+
+	if final.Put != 5 || final.InFlight != 0 {
+		t.Errorf("WithStats() got %+v; want 5 put", final)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// A StoreOf value is somewhere Ts are fetched from and put in. Its methods are
+// safe for concurrent use and their method values are a ContextFetcherOf and a
+// ContextPutterOf, so a StoreOf can be given straight to MoveContextOf.
+type StoreOf[T any] interface {
+	// Fetch returns the next T and true, or false once there are no more.
+	Fetch(ctx context.Context) (_ T, ok bool, _ error)
+	// Put stores t.
+	Put(ctx context.Context, t T) error
+}
+
+// A Store value is a StoreOf for Things.
+type Store = StoreOf[Thing]
+
+// A MemStore keeps its Ts in memory. Fetch hands out the Ts it was made with
+// and Put collects new ones, the two don't mix.
+type MemStore[T any] struct {
+	mu      sync.Mutex
+	toFetch []T
+	curr    int
+	gotPut  []T
+}
+
+// NewMemStore returns a MemStore that fetches items in order.
+func NewMemStore[T any](items ...T) *MemStore[T] {
+	return &MemStore[T]{toFetch: items}
+}
+
+// Fetch returns the next of the items the store was made with.
+func (s *MemStore[T]) Fetch(ctx context.Context) (t T, ok bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return t, false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.curr >= len(s.toFetch) {
+		return t, false, nil
+	}
+
+	s.curr++
+	return s.toFetch[s.curr-1], true, nil
+}
+
+// Put adds t to the items that have been put.
+func (s *MemStore[T]) Put(ctx context.Context, t T) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.gotPut = append(s.gotPut, t)
+	return nil
+}
+
+// Items returns a copy of the items that have been put, in the order they
+// were put.
+func (s *MemStore[T]) Items() []T {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]T(nil), s.gotPut...)
+}
+
+// ErrInjected is the error a SimulatedStore fails with on purpose.
+var ErrInjected = errors.New("simulated store failure")
+
+// A SimulatedStore wraps a StoreOf to make it as slow and unreliable as the
+// real thing, for tests and demos. Its fields must be set before it's used.
+type SimulatedStore[T any] struct {
+	Store StoreOf[T]
+
+	// every call waits this long before it goes through, or until its
+	// context is done
+	FetchLatency, PutLatency time.Duration
+
+	// FailEvery makes every FailEvery-th call to Fetch or Put fail with
+	// ErrInjected, 0 never does.
+	FailEvery int
+	// FailRate is the chance, between 0 and 1, of any call failing with
+	// ErrInjected.
+	FailRate float64
+
+	mu    sync.Mutex
+	calls int
+}
+
+// Fetch fetches from the wrapped store after FetchLatency, unless the call is
+// picked to fail.
+func (s *SimulatedStore[T]) Fetch(ctx context.Context) (t T, ok bool, err error) {
+	if err := s.simulate(ctx, s.FetchLatency); err != nil {
+		return t, false, err
+	}
+	return s.Store.Fetch(ctx)
+}
+
+// Put puts t in the wrapped store after PutLatency, unless the call is picked
+// to fail.
+func (s *SimulatedStore[T]) Put(ctx context.Context, t T) error {
+	if err := s.simulate(ctx, s.PutLatency); err != nil {
+		return err
+	}
+	return s.Store.Put(ctx, t)
+}
+
+func (s *SimulatedStore[T]) simulate(ctx context.Context, latency time.Duration) error {
+	s.mu.Lock()
+	s.calls++
+	fail := s.FailEvery > 0 && s.calls%s.FailEvery == 0
+	s.mu.Unlock()
+
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	if fail || (s.FailRate > 0 && rand.Float64() < s.FailRate) {
+		return ErrInjected
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A JSONLinesStore keeps its Ts in a file, one JSON document per line. Fetch
+// reads the file from the start and Put appends to it. A Thing read back
+// from the file is whatever encoding/json makes of it, numbers come back as
+// float64.
+type JSONLinesStore[T any] struct {
+	path string
+
+	mu  sync.Mutex
+	r   *os.File
+	dec *json.Decoder
+	w   *os.File
+}
+
+// NewJSONLinesStore returns a JSONLinesStore for the file at path, the file is
+// only opened once it's used.
+func NewJSONLinesStore[T any](path string) *JSONLinesStore[T] {
+	return &JSONLinesStore[T]{path: path}
+}
+
+// Fetch decodes the next line of the file, a missing file has nothing to
+// fetch.
+func (s *JSONLinesStore[T]) Fetch(ctx context.Context) (t T, ok bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return t, false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dec == nil {
+		f, err := os.Open(s.path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return t, false, nil
+		}
+		if err != nil {
+			return t, false, err
+		}
+		s.r, s.dec = f, json.NewDecoder(f)
+	}
+
+	if err := s.dec.Decode(&t); err != nil {
+		if err == io.EOF {
+			return t, false, nil
+		}
+		return t, false, fmt.Errorf("%s: %w", s.path, err)
+	}
+	return t, true, nil
+}
+
+// Put appends t to the file as a line of JSON, the file is created if it
+// doesn't exist.
+func (s *JSONLinesStore[T]) Put(ctx context.Context, t T) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.w == nil {
+		f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			return err
+		}
+		s.w = f
+	}
+
+	_, err = s.w.Write(append(b, '\n'))
+	return err
+}
+
+// Close closes the file, the store can't be used anymore after that.
+func (s *JSONLinesStore[T]) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	if s.r != nil {
+		err = s.r.Close()
+	}
+	if s.w != nil {
+		if wErr := s.w.Close(); err == nil {
+			err = wErr
+		}
+	}
+	return err
+}
+
+// A DirStore keeps every T in its own JSON file in a directory, the files are
+// numbered in the order the Ts were put. Fetch goes through the files that
+// were there the first time it's called, in order.
+type DirStore[T any] struct {
+	dir string
+
+	mu     sync.Mutex
+	listed bool
+	names  []string // left to fetch
+	next   int      // number of the next file put
+}
+
+// NewDirStore returns a DirStore for the directory dir, which is created on
+// the first Put if it doesn't exist.
+func NewDirStore[T any](dir string) *DirStore[T] {
+	return &DirStore[T]{dir: dir}
+}
+
+const dirStoreExt = ".json"
+
+// list finds the files of the store and the number the next one should get.
+func (s *DirStore[T]) list() error {
+	if s.listed {
+		return nil
+	}
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	// a file of the store is named after a number that isn't negative, the
+	// ones put elsewhere may not be zero padded so they're sorted by number
+	type numbered struct {
+		n    int
+		name string
+	}
+	var files []numbered
+	for _, e := range entries {
+		name := e.Name()
+		n, err := strconv.Atoi(strings.TrimSuffix(name, dirStoreExt))
+		if e.IsDir() || !strings.HasSuffix(name, dirStoreExt) || err != nil || n < 0 {
+			continue
+		}
+
+		files = append(files, numbered{n, name})
+		if n >= s.next {
+			s.next = n + 1
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].n < files[j].n
+	})
+	for _, f := range files {
+		s.names = append(s.names, f.name)
+	}
+	s.listed = true
+	return nil
+}
+
+// Fetch decodes the next file of the directory.
+func (s *DirStore[T]) Fetch(ctx context.Context) (t T, ok bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return t, false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.list(); err != nil {
+		return t, false, err
+	}
+
+	if len(s.names) == 0 {
+		return t, false, nil
+	}
+
+	name := filepath.Join(s.dir, s.names[0])
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return t, false, err
+	}
+
+	if err := json.Unmarshal(b, &t); err != nil {
+		return t, false, fmt.Errorf("%s: %w", name, err)
+	}
+	s.names = s.names[1:]
+	return t, true, nil
+}
+
+// Put writes t to the next file of the directory. The file is written under
+// a temporary name first so Fetch never sees half of it.
+func (s *DirStore[T]) Put(ctx context.Context, t T) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.list(); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, "put-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%020d%s", s.next, dirStoreExt)
+	if err := os.Rename(tmp.Name(), filepath.Join(s.dir, name)); err != nil {
+		return err
+	}
+	s.next++
+	return nil
+}
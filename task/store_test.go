@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/go-cmp/cmp"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var (
+	_ StoreOf[int] = (*MemStore[int])(nil)
+	_ StoreOf[int] = (*JSONLinesStore[int])(nil)
+	_ StoreOf[int] = (*DirStore[int])(nil)
+	_ StoreOf[int] = (*SimulatedStore[int])(nil)
+)
+
+func TestMemStoreConcurrentMove(t *testing.T) {
+	checkLeaks(t)
+
+	items := make([]int, 100)
+	for i := range items {
+		items[i] = i
+	}
+	src, dst := NewMemStore(items...), NewMemStore[int]()
+
+	if err := MoveContextOf(context.Background(), 8, src.Fetch, dst.Put); err != nil {
+		t.Fatalf("MoveContextOf() got err %v; want %v", err, nil)
+	}
+
+	got := dst.Items()
+	sort.Ints(got)
+	if diff := cmp.Diff(items, got); diff != "" {
+		t.Errorf("MoveContextOf() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// roundTrip moves items into dst, then out of fetchFrom into a MemStore.
+func roundTrip[T any](t *testing.T, items []T, dst, fetchFrom StoreOf[T]) []T {
+	t.Helper()
+
+	ctx := context.Background()
+	if err := MoveContextOf(ctx, 1, NewMemStore(items...).Fetch, dst.Put); err != nil {
+		t.Fatalf("MoveContextOf() into the store got err %v", err)
+	}
+
+	got := NewMemStore[T]()
+	if err := MoveContextOf(ctx, 1, fetchFrom.Fetch, got.Put); err != nil {
+		t.Fatalf("MoveContextOf() out of the store got err %v", err)
+	}
+	return got.Items()
+}
+
+type book struct {
+	Title string
+	Year  int
+}
+
+func TestJSONLinesStore(t *testing.T) {
+	checkLeaks(t)
+
+	path := filepath.Join(t.TempDir(), "books.jsonl")
+	books := []book{{"Concurrency in Go", 2017}, {"Isomorphic Go", 2017}}
+
+	dst := NewJSONLinesStore[book](path)
+	defer dst.Close()
+	src := NewJSONLinesStore[book](path)
+	defer src.Close()
+
+	if diff := cmp.Diff(books, roundTrip[book](t, books, dst, src)); diff != "" {
+		t.Errorf("JSONLinesStore mismatch (-want +got):\n%s", diff)
+	}
+
+	// a missing file is an empty store
+	empty := NewJSONLinesStore[book](filepath.Join(t.TempDir(), "missing.jsonl"))
+	if _, ok, err := empty.Fetch(context.Background()); ok || err != nil {
+		t.Errorf("Fetch() of a missing file got %t, %v; want false, <nil>", ok, err)
+	}
+}
+
+func TestDirStore(t *testing.T) {
+	checkLeaks(t)
+
+	dir := filepath.Join(t.TempDir(), "books")
+	books := []book{{"Go BluePrints", 2016}, {"Master Go", 2018}}
+
+	got := roundTrip[book](t, books, NewDirStore[book](dir), NewDirStore[book](dir))
+	if diff := cmp.Diff(books, got); diff != "" {
+		t.Errorf("DirStore mismatch (-want +got):\n%s", diff)
+	}
+
+	// a new store on the same directory numbers its files after the old ones
+	more := []book{{"Go Library Cookbook", 2018}}
+	got = roundTrip[book](t, more, NewDirStore[book](dir), NewDirStore[book](dir))
+	if diff := cmp.Diff(append(books, more...), got); diff != "" {
+		t.Errorf("DirStore mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDirStoreNumberOrder(t *testing.T) {
+	checkLeaks(t)
+
+	// files that weren't zero padded, and one that isn't part of the store
+	dir := t.TempDir()
+	for _, n := range []int{10, 9, -1, 2} {
+		name := filepath.Join(dir, strconv.Itoa(n)+dirStoreExt)
+		if err := os.WriteFile(name, []byte(strconv.Itoa(n)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := NewDirStore[int](dir)
+	if err := s.Put(context.Background(), 11); err != nil {
+		t.Fatalf("Put() got err %v; want %v", err, nil)
+	}
+
+	var got []int
+	for {
+		i, ok, err := s.Fetch(context.Background())
+		if err != nil {
+			t.Fatalf("Fetch() got err %v; want %v", err, nil)
+		}
+		if !ok {
+			break
+		}
+		got = append(got, i)
+	}
+
+	// the Put is numbered after the last file, but Fetch only goes through
+	// the files that were there before it
+	if diff := cmp.Diff([]int{2, 9, 10}, got); diff != "" {
+		t.Errorf("DirStore mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, fmt.Sprintf("%020d%s", 11, dirStoreExt))); err != nil {
+		t.Errorf("Put() didn't number its file after the last one: %v", err)
+	}
+}
+
+func TestSimulatedStore(t *testing.T) {
+	checkLeaks(t)
+
+	t.Run("fail every", func(t *testing.T) {
+		s := &SimulatedStore[int]{
+			Store:     NewMemStore(1, 2, 3, 4),
+			FailEvery: 3,
+		}
+
+		var errs int
+		for i := 0; i < 6; i++ {
+			if _, _, err := s.Fetch(context.Background()); err == ErrInjected {
+				errs++
+			}
+		}
+
+		if errs != 2 {
+			t.Errorf("Fetch() failed %d times; want 2", errs)
+		}
+	})
+
+	t.Run("latency is cancelled", func(t *testing.T) {
+		s := &SimulatedStore[int]{
+			Store:      NewMemStore[int](),
+			PutLatency: time.Hour,
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		if err := s.Put(ctx, 1); err != context.DeadlineExceeded {
+			t.Errorf("Put() got err %v; want %v", err, context.DeadlineExceeded)
+		}
+	})
+}
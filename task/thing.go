@@ -0,0 +1,59 @@
+package main
+
+import "context"
+
+// A Thing is a dummy type that we are using for the exercise. It is "fetched"
+// from a source and "put" in a destination.
+type Thing interface{}
+
+// A Fetcher function returns a Thing and a flag similar to the existence flag
+// in a map—it will return true until there are no more Things and then return
+// false.
+type Fetcher = FetcherOf[Thing]
+
+// A MaybeFetcher function is exactly the same as a Fetcher except that it may
+// return an error.
+type MaybeFetcher = MaybeFetcherOf[Thing]
+
+// A Putter function accepts a Thing and stores it.
+type Putter = PutterOf[Thing]
+
+// A MaybePutter function is exactly the same as a Putter except that it may
+// return an error.
+type MaybePutter = MaybePutterOf[Thing]
+
+// Move is MoveOf for Things.
+func Move(fetch Fetcher, put Putter, opts ...MoveOption) {
+	MoveOf(fetch, put, opts...)
+}
+
+// MoveBounded is MoveBoundedOf for Things.
+func MoveBounded(limit int, fetch Fetcher, put Putter, opts ...MoveOption) {
+	MoveBoundedOf(limit, fetch, put, opts...)
+}
+
+// MaybeMove is MaybeMoveOf for Things.
+func MaybeMove(fetch MaybeFetcher, put MaybePutter, opts ...MoveOption) error {
+	return MaybeMoveOf(fetch, put, opts...)
+}
+
+// MoveCtx is MoveCtxOf for Things.
+func MoveCtx(ctx context.Context, fetch Fetcher, put Putter, opts ...MoveOption) error {
+	return MoveCtxOf(ctx, fetch, put, opts...)
+}
+
+// MoveLots is MoveLotsOf for Things.
+func MoveLots(n int, fetch Fetcher, put Putter, opts ...MoveOption) {
+	MoveLotsOf(n, fetch, put, opts...)
+}
+
+// MaybeMoveLots is MaybeMoveLotsOf for Things.
+func MaybeMoveLots(
+	ctx context.Context,
+	n int,
+	fetch MaybeFetcher,
+	put MaybePutter,
+	opts ...MoveOption,
+) error {
+	return MaybeMoveLotsOf(ctx, n, fetch, put, opts...)
+}